@@ -1,17 +1,130 @@
 package main
 
 import (
+	"encoding/hex"
+	"flag"
 	"fmt"
 	"log"
+	"os"
+	"strings"
 
 	"github.com/vsekhar/hashmachine"
+	"github.com/vsekhar/hashmachine/pkg/hm"
 	"google.golang.org/protobuf/encoding/prototext"
 	"google.golang.org/protobuf/proto"
 )
 
+var hmacKeyFile = flag.String("hmac-key-file", "", "file containing the hex-encoded key for programs that use HMAC")
+
+func usage() {
+	fmt.Fprintf(flag.CommandLine.Output(), `Usage:
+  hashmachine [flags] verify <program> <expected-hex> [input-file...]
+  hashmachine demo
+
+Program files ending in .textproto or .txtpb are read as text protos,
+otherwise as binary protos. Input files are streamed.
+
+Flags:
+`)
+	flag.PrintDefaults()
+}
+
 func main() {
-	// TODO: `hashmachine verify` command.
+	flag.Usage = usage
+	flag.Parse()
+	switch flag.Arg(0) {
+	case "verify":
+		if flag.NArg() < 3 {
+			usage()
+			os.Exit(2)
+		}
+		verify(flag.Arg(1), flag.Arg(2), flag.Args()[3:])
+	case "demo":
+		demo()
+	default:
+		usage()
+		os.Exit(2)
+	}
+}
+
+func readProgram(path string) (*hashmachine.Program, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	p := new(hashmachine.Program)
+	if strings.HasSuffix(path, ".textproto") || strings.HasSuffix(path, ".txtpb") {
+		err = prototext.Unmarshal(b, p)
+	} else {
+		err = proto.Unmarshal(b, p)
+	}
+	return p, err
+}
+
+func verify(programPath, expectedHex string, inputPaths []string) {
+	ok, err := verifyFiles(programPath, expectedHex, inputPaths)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	if !ok {
+		fmt.Println("FAIL")
+		os.Exit(1)
+	}
+	fmt.Println("OK")
+}
+
+// verifyFiles verifies the program at programPath with the inputs at
+// inputPaths, closing the inputs before it returns.
+func verifyFiles(programPath, expectedHex string, inputPaths []string) (bool, error) {
+	p, err := readProgram(programPath)
+	if err != nil {
+		return false, fmt.Errorf("failed to read program: %w", err)
+	}
+	expected, err := hex.DecodeString(expectedHex)
+	if err != nil {
+		return false, fmt.Errorf("failed to decode expected output: %w", err)
+	}
+	var opts []hm.Option
+	if *hmacKeyFile != "" {
+		key, err := readHMACKey(*hmacKeyFile)
+		if err != nil {
+			return false, fmt.Errorf("failed to read HMAC key: %w", err)
+		}
+		opts = append(opts, hm.WithHMACKey(key))
+	}
+	var files []*os.File
+	defer func() {
+		for _, f := range files {
+			f.Close()
+		}
+	}()
+	var inputs []*hm.Input
+	for _, path := range inputPaths {
+		f, err := os.Open(path)
+		if err != nil {
+			return false, fmt.Errorf("failed to open input: %w", err)
+		}
+		files = append(files, f)
+		inputs = append(inputs, hm.ReaderInput(f))
+	}
+	ok, err := hm.VerifyInputs(p, inputs, expected, opts...)
+	if err != nil {
+		return false, fmt.Errorf("failed to execute program: %w", err)
+	}
+	return ok, nil
+}
+
+// readHMACKey reads a hex-encoded key from path, ignoring surrounding
+// whitespace such as a trailing newline.
+func readHMACKey(path string) ([]byte, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return hex.DecodeString(strings.TrimSpace(string(b)))
+}
 
+func demo() {
 	// Try some stuff out
 	var hashInput3 *hashmachine.Program = &hashmachine.Program{
 		Metadata: &hashmachine.ProgramMetadata{
@@ -5,5 +5,6 @@ go 1.16
 require (
 	github.com/golang/protobuf v1.5.2
 	golang.org/x/crypto v0.0.0-20210711020723-a769d52b0f97
+	golang.org/x/mod v0.4.2
 	google.golang.org/protobuf v1.27.1
 )
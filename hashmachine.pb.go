@@ -1,16 +1,15 @@
 // Code generated by protoc-gen-go. DO NOT EDIT.
 // versions:
-// 	protoc-gen-go v1.25.0
+// 	protoc-gen-go v1.27.1
 // 	protoc        v3.12.4
 // source: hashmachine.proto
 
 package hashmachine
 
 import (
-	proto "github.com/golang/protobuf/proto"
-	descriptor "github.com/golang/protobuf/protoc-gen-go/descriptor"
 	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
 	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	descriptorpb "google.golang.org/protobuf/types/descriptorpb"
 	reflect "reflect"
 	sync "sync"
 )
@@ -22,10 +21,6 @@ const (
 	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
 )
 
-// This is a compile-time assertion that a sufficiently up-to-date version
-// of the legacy proto package is being used.
-const _ = proto.ProtoPackageIsVersion4
-
 // HashFunctionOutputLength describes whether a HashFunction has fixed or
 // variable length output.
 //
@@ -88,6 +83,9 @@ const (
 	HashFunction_HASHFUNCTION_UNKNOWN  HashFunction = 0
 	HashFunction_HASHFUNCTION_SHA_256  HashFunction = 1
 	HashFunction_HASHFUNCTION_SHA3_512 HashFunction = 2
+	// HASHFUNCTION_SHA_256D is SHA-256 applied twice, SHA-256(SHA-256(x)), as
+	// used by Bitcoin.
+	HashFunction_HASHFUNCTION_SHA_256D HashFunction = 3
 )
 
 // Enum value maps for HashFunction.
@@ -96,11 +94,13 @@ var (
 		0: "HASHFUNCTION_UNKNOWN",
 		1: "HASHFUNCTION_SHA_256",
 		2: "HASHFUNCTION_SHA3_512",
+		3: "HASHFUNCTION_SHA_256D",
 	}
 	HashFunction_value = map[string]int32{
 		"HASHFUNCTION_UNKNOWN":  0,
 		"HASHFUNCTION_SHA_256":  1,
 		"HASHFUNCTION_SHA3_512": 2,
+		"HASHFUNCTION_SHA_256D": 3,
 	}
 )
 
@@ -131,6 +131,63 @@ func (HashFunction) EnumDescriptor() ([]byte, []int) {
 	return file_hashmachine_proto_rawDescGZIP(), []int{1}
 }
 
+// NodePosition describes the position of a node committed to in its hash.
+type NodePosition int32
+
+const (
+	// NODEPOSITION_NONE does not commit to the position of nodes.
+	NodePosition_NODEPOSITION_NONE NodePosition = 0
+	// NODEPOSITION_HEIGHT commits to the height of a node: zero for leaves
+	// and one more than the greatest height of its children for interior
+	// nodes.
+	NodePosition_NODEPOSITION_HEIGHT NodePosition = 1
+	// NODEPOSITION_INDEX commits to the index of a node in level order: zero
+	// for the root and n * branching_factor + i + 1 for the i'th child of the
+	// node with index n.
+	NodePosition_NODEPOSITION_INDEX NodePosition = 2
+)
+
+// Enum value maps for NodePosition.
+var (
+	NodePosition_name = map[int32]string{
+		0: "NODEPOSITION_NONE",
+		1: "NODEPOSITION_HEIGHT",
+		2: "NODEPOSITION_INDEX",
+	}
+	NodePosition_value = map[string]int32{
+		"NODEPOSITION_NONE":   0,
+		"NODEPOSITION_HEIGHT": 1,
+		"NODEPOSITION_INDEX":  2,
+	}
+)
+
+func (x NodePosition) Enum() *NodePosition {
+	p := new(NodePosition)
+	*p = x
+	return p
+}
+
+func (x NodePosition) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (NodePosition) Descriptor() protoreflect.EnumDescriptor {
+	return file_hashmachine_proto_enumTypes[2].Descriptor()
+}
+
+func (NodePosition) Type() protoreflect.EnumType {
+	return &file_hashmachine_proto_enumTypes[2]
+}
+
+func (x NodePosition) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use NodePosition.Descriptor instead.
+func (NodePosition) EnumDescriptor() ([]byte, []int) {
+	return file_hashmachine_proto_rawDescGZIP(), []int{2}
+}
+
 // OpCode identifies the operation to be performed.
 type OpCode int32
 
@@ -184,29 +241,191 @@ const (
 	// the input indentified by 'index'. If the values match, the program
 	// proceeds. If the values do not match, the program fails verification.
 	OpCode_OPCODE_MATCH_INPUT OpCode = 7
+	// OPCODE_PUSH_INPUT_HASHED hashes 'payload' followed by the input value at
+	// 'index' and pushes the hash sum onto the stack.
+	//
+	// 'payload' is an optional leaf prefix (e.g. 0x00 for RFC 6962 leaves) or
+	// salt. Salting leaves with secret random salts protects low-entropy
+	// values from dictionary attacks on the root; a proof reveals only the
+	// salt of the leaf it proves.
+	// OPCODE_PUSH_INPUT_HASHED lets the program commit to how a leaf is derived
+	// from its input, so that raw data can be verified against a root without
+	// the caller hashing it first.
+	//
+	// The program is invalid if there is no input at 'index'.
+	OpCode_OPCODE_PUSH_INPUT_HASHED OpCode = 8
+	// OPCODE_MATCH_OUTPUT pops the top value of the stack and compares it with
+	// the output identified by 'index'. If the values do not match, the program
+	// fails verification.
+	//
+	// The program is invalid if 'index' is not less than
+	// metadata.expected_output_count or if the output at 'index' has already
+	// been matched.
+	OpCode_OPCODE_MATCH_OUTPUT OpCode = 9
+	// OPCODE_POP_CHILDREN_AND_DATA_PUSH_HASH pops metadata.branching_factor
+	// values from the stack, hashing each in pop order, then pops one more
+	// value, the node's data, and hashes it last. It pushes the hash sum onto
+	// the stack.
+	//
+	// OPCODE_POP_CHILDREN_AND_DATA_PUSH_HASH supports trees whose interior
+	// nodes carry data of their own, where a node's hash covers its children
+	// followed by its data. The node's data is pushed before its children.
+	//
+	// The program is invalid if the stack underflows.
+	OpCode_OPCODE_POP_CHILDREN_AND_DATA_PUSH_HASH OpCode = 10
+	// OPCODE_MATCH_BYTES pops the top value of the stack and compares it with
+	// 'payload'. If the values match, the program proceeds. If the values do
+	// not match, the program fails verification.
+	//
+	// OPCODE_MATCH_BYTES anchors a proof to a known value, such as a published
+	// checkpoint, partway through the program.
+	OpCode_OPCODE_MATCH_BYTES OpCode = 11
+	// OPCODE_CONCAT pops 'index' values from the stack and pushes their
+	// concatenation in pop order. The result is the byte string that
+	// OPCODE_POP_N_PUSH_HASH would hash for the same values.
+	//
+	// The program is invalid if the stack underflows.
+	OpCode_OPCODE_CONCAT OpCode = 12
+	// OPCODE_PREPEND replaces the top value of the stack with 'payload'
+	// followed by that value.
+	//
+	// OPCODE_PREPEND is useful for hashing values wrapped in a fixed header,
+	// such as git's "blob <len>\0".
+	//
+	// The program is invalid if the stack underflows.
+	OpCode_OPCODE_PREPEND OpCode = 13
+	// OPCODE_APPEND replaces the top value of the stack with that value
+	// followed by 'payload'.
+	//
+	// The program is invalid if the stack underflows.
+	OpCode_OPCODE_APPEND OpCode = 14
+	// OPCODE_SLICE replaces the top value of the stack with 'length' bytes of
+	// that value starting at offset 'index'.
+	//
+	// The program is invalid if the stack underflows or if the slice is out of
+	// range.
+	OpCode_OPCODE_SLICE OpCode = 15
+	// OPCODE_DUP pushes a copy of the value 'index' positions from the top of
+	// the stack (0 == top of stack).
+	//
+	// The program is invalid if the stack underflows.
+	OpCode_OPCODE_DUP OpCode = 16
+	// OPCODE_SWAP exchanges the top value of the stack with the value 'index'
+	// positions from the top. 'index' must be at least 1.
+	//
+	// The program is invalid if the stack underflows.
+	OpCode_OPCODE_SWAP OpCode = 17
+	// OPCODE_ROT moves the third value from the top of the stack to the top,
+	// i.e. (a b c -- b c a).
+	//
+	// The program is invalid if the stack underflows.
+	OpCode_OPCODE_ROT OpCode = 18
+	// OPCODE_DROP pops and discards the top value of the stack.
+	//
+	// The program is invalid if the stack underflows.
+	OpCode_OPCODE_DROP OpCode = 19
+	// OPCODE_POP_SORTED_CHILDREN_PUSH_HASH pops metadata.branching_factor
+	// values from the stack, sorts them in ascending bytewise order, hashes
+	// each in sorted order, gets the hash sum and pushes it onto the stack.
+	//
+	// OPCODE_POP_SORTED_CHILDREN_PUSH_HASH supports commutative trees (e.g.
+	// hashing min(a,b) || max(a,b)) where proofs do not depend on the
+	// position of each child.
+	//
+	// The program is invalid if the stack underflows.
+	OpCode_OPCODE_POP_SORTED_CHILDREN_PUSH_HASH OpCode = 20
+	// OPCODE_REPEAT_HASH replaces the top value of the stack with the result of
+	// hashing it 'index' times. If 'payload' is set, the first hash covers the
+	// top value followed by 'payload'; subsequent hashes cover only the
+	// previous hash sum.
+	//
+	// OPCODE_REPEAT_HASH compactly encodes iterated hash chains (e.g. one-time
+	// passwords and sequential timestamp chains). Values can be mixed into a
+	// chain at given positions with a sequence of OPCODE_REPEAT_HASH ops, each
+	// with its own 'payload'.
+	//
+	// The program is invalid if the stack underflows or if 'index' is zero.
+	OpCode_OPCODE_REPEAT_HASH OpCode = 21
+	// OPCODE_PUSH_LITERAL pushes the program's literal at 'index' onto the
+	// stack.
+	//
+	// OPCODE_PUSH_LITERAL avoids repeating a payload that is pushed many times
+	// in the same program.
+	//
+	// The program is invalid if there is no literal at 'index'.
+	OpCode_OPCODE_PUSH_LITERAL OpCode = 22
+	// OPCODE_CALL executes the ops of the program's subroutine at 'index' as
+	// though they appeared in place of the OPCODE_CALL op.
+	//
+	// A subroutine may only call subroutines with a lower index, so programs
+	// cannot recurse and always terminate.
+	//
+	// The program is invalid if there is no subroutine at 'index'.
+	OpCode_OPCODE_CALL OpCode = 23
+	// OPCODE_PUSH_PARAM pushes the template parameter at 'index' onto the
+	// stack.
+	//
+	// OPCODE_PUSH_PARAM may only appear in a Template. Instantiating the
+	// template replaces each OPCODE_PUSH_PARAM with OPCODE_PUSH_BYTES. A
+	// program that executes OPCODE_PUSH_PARAM is invalid.
+	OpCode_OPCODE_PUSH_PARAM OpCode = 24
 )
 
 // Enum value maps for OpCode.
 var (
 	OpCode_name = map[int32]string{
-		0: "OPCODE_UNKNOWN",
-		1: "OPCODE_INVALID",
-		2: "OPCODE_PUSH_INPUT",
-		3: "OPCODE_PUSH_BYTES",
-		4: "OPCODE_POP_CHILDREN_PUSH_HASH",
-		5: "OPCODE_POP_N_PUSH_HASH",
-		6: "OPCODE_PEAK_N_PUSH_HASH",
-		7: "OPCODE_MATCH_INPUT",
+		0:  "OPCODE_UNKNOWN",
+		1:  "OPCODE_INVALID",
+		2:  "OPCODE_PUSH_INPUT",
+		3:  "OPCODE_PUSH_BYTES",
+		4:  "OPCODE_POP_CHILDREN_PUSH_HASH",
+		5:  "OPCODE_POP_N_PUSH_HASH",
+		6:  "OPCODE_PEAK_N_PUSH_HASH",
+		7:  "OPCODE_MATCH_INPUT",
+		8:  "OPCODE_PUSH_INPUT_HASHED",
+		9:  "OPCODE_MATCH_OUTPUT",
+		10: "OPCODE_POP_CHILDREN_AND_DATA_PUSH_HASH",
+		11: "OPCODE_MATCH_BYTES",
+		12: "OPCODE_CONCAT",
+		13: "OPCODE_PREPEND",
+		14: "OPCODE_APPEND",
+		15: "OPCODE_SLICE",
+		16: "OPCODE_DUP",
+		17: "OPCODE_SWAP",
+		18: "OPCODE_ROT",
+		19: "OPCODE_DROP",
+		20: "OPCODE_POP_SORTED_CHILDREN_PUSH_HASH",
+		21: "OPCODE_REPEAT_HASH",
+		22: "OPCODE_PUSH_LITERAL",
+		23: "OPCODE_CALL",
+		24: "OPCODE_PUSH_PARAM",
 	}
 	OpCode_value = map[string]int32{
-		"OPCODE_UNKNOWN":                0,
-		"OPCODE_INVALID":                1,
-		"OPCODE_PUSH_INPUT":             2,
-		"OPCODE_PUSH_BYTES":             3,
-		"OPCODE_POP_CHILDREN_PUSH_HASH": 4,
-		"OPCODE_POP_N_PUSH_HASH":        5,
-		"OPCODE_PEAK_N_PUSH_HASH":       6,
-		"OPCODE_MATCH_INPUT":            7,
+		"OPCODE_UNKNOWN":                         0,
+		"OPCODE_INVALID":                         1,
+		"OPCODE_PUSH_INPUT":                      2,
+		"OPCODE_PUSH_BYTES":                      3,
+		"OPCODE_POP_CHILDREN_PUSH_HASH":          4,
+		"OPCODE_POP_N_PUSH_HASH":                 5,
+		"OPCODE_PEAK_N_PUSH_HASH":                6,
+		"OPCODE_MATCH_INPUT":                     7,
+		"OPCODE_PUSH_INPUT_HASHED":               8,
+		"OPCODE_MATCH_OUTPUT":                    9,
+		"OPCODE_POP_CHILDREN_AND_DATA_PUSH_HASH": 10,
+		"OPCODE_MATCH_BYTES":                     11,
+		"OPCODE_CONCAT":                          12,
+		"OPCODE_PREPEND":                         13,
+		"OPCODE_APPEND":                          14,
+		"OPCODE_SLICE":                           15,
+		"OPCODE_DUP":                             16,
+		"OPCODE_SWAP":                            17,
+		"OPCODE_ROT":                             18,
+		"OPCODE_DROP":                            19,
+		"OPCODE_POP_SORTED_CHILDREN_PUSH_HASH":   20,
+		"OPCODE_REPEAT_HASH":                     21,
+		"OPCODE_PUSH_LITERAL":                    22,
+		"OPCODE_CALL":                            23,
+		"OPCODE_PUSH_PARAM":                      24,
 	}
 )
 
@@ -221,11 +440,11 @@ func (x OpCode) String() string {
 }
 
 func (OpCode) Descriptor() protoreflect.EnumDescriptor {
-	return file_hashmachine_proto_enumTypes[2].Descriptor()
+	return file_hashmachine_proto_enumTypes[3].Descriptor()
 }
 
 func (OpCode) Type() protoreflect.EnumType {
-	return &file_hashmachine_proto_enumTypes[2]
+	return &file_hashmachine_proto_enumTypes[3]
 }
 
 func (x OpCode) Number() protoreflect.EnumNumber {
@@ -234,7 +453,60 @@ func (x OpCode) Number() protoreflect.EnumNumber {
 
 // Deprecated: Use OpCode.Descriptor instead.
 func (OpCode) EnumDescriptor() ([]byte, []int) {
-	return file_hashmachine_proto_rawDescGZIP(), []int{2}
+	return file_hashmachine_proto_rawDescGZIP(), []int{3}
+}
+
+// ParamType constrains the values a template parameter can take.
+type ParamType int32
+
+const (
+	ParamType_PARAMTYPE_UNKNOWN ParamType = 0
+	// PARAMTYPE_BYTES parameters can be any byte string.
+	ParamType_PARAMTYPE_BYTES ParamType = 1
+	// PARAMTYPE_DIGEST parameters must be exactly as long as the output of the
+	// program's hash function.
+	ParamType_PARAMTYPE_DIGEST ParamType = 2
+)
+
+// Enum value maps for ParamType.
+var (
+	ParamType_name = map[int32]string{
+		0: "PARAMTYPE_UNKNOWN",
+		1: "PARAMTYPE_BYTES",
+		2: "PARAMTYPE_DIGEST",
+	}
+	ParamType_value = map[string]int32{
+		"PARAMTYPE_UNKNOWN": 0,
+		"PARAMTYPE_BYTES":   1,
+		"PARAMTYPE_DIGEST":  2,
+	}
+)
+
+func (x ParamType) Enum() *ParamType {
+	p := new(ParamType)
+	*p = x
+	return p
+}
+
+func (x ParamType) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (ParamType) Descriptor() protoreflect.EnumDescriptor {
+	return file_hashmachine_proto_enumTypes[4].Descriptor()
+}
+
+func (ParamType) Type() protoreflect.EnumType {
+	return &file_hashmachine_proto_enumTypes[4]
+}
+
+func (x ParamType) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use ParamType.Descriptor instead.
+func (ParamType) EnumDescriptor() ([]byte, []int) {
+	return file_hashmachine_proto_rawDescGZIP(), []int{4}
 }
 
 // HashConfig specifies the configuration for hashing operations used in
@@ -254,6 +526,29 @@ type HashConfig struct {
 	// For hashes with fixed-length outputs, this must not be set or set to
 	// zero, otherwise the program is invalid.
 	HashOutputLengthBytes uint32 `protobuf:"varint,2,opt,name=hash_output_length_bytes,json=hashOutputLengthBytes,proto3" json:"hash_output_length_bytes,omitempty"`
+	// truncate_output_bytes, if non-zero, truncates each hash output to its
+	// first truncate_output_bytes bytes. It must not exceed the hash
+	// function's output length (hash_output_length_bytes for variable-length
+	// hash functions), otherwise the program is invalid.
+	//
+	// Truncation weakens collision resistance to about 2^(4 * n) work for
+	// n-byte outputs.
+	TruncateOutputBytes uint32 `protobuf:"varint,3,opt,name=truncate_output_bytes,json=truncateOutputBytes,proto3" json:"truncate_output_bytes,omitempty"`
+	// hmac, if set, keys the hash function with HMAC (RFC 2104). The key is
+	// not part of the program; it is supplied when the program is executed.
+	// HMAC requires a fixed-length hash function, otherwise the program is
+	// invalid.
+	Hmac bool `protobuf:"varint,4,opt,name=hmac,proto3" json:"hmac,omitempty"`
+	// node_position, if set, makes OPCODE_POP_CHILDREN_PUSH_HASH,
+	// OPCODE_POP_CHILDREN_AND_DATA_PUSH_HASH and
+	// OPCODE_POP_SORTED_CHILDREN_PUSH_HASH commit to the position of the node
+	// being hashed. The position is taken from the op's 'index' and hashed,
+	// encoded as an 8-byte big-endian integer, before the node's children.
+	// node_position says what the position is, so that proof generators can
+	// fill it in. The machine does not derive or check positions: a program
+	// can hash any position, so node_position alone does not prevent
+	// structural confusion in proofs from untrusted sources.
+	NodePosition NodePosition `protobuf:"varint,5,opt,name=node_position,json=nodePosition,proto3,enum=hashmachine.NodePosition" json:"node_position,omitempty"`
 }
 
 func (x *HashConfig) Reset() {
@@ -302,6 +597,27 @@ func (x *HashConfig) GetHashOutputLengthBytes() uint32 {
 	return 0
 }
 
+func (x *HashConfig) GetTruncateOutputBytes() uint32 {
+	if x != nil {
+		return x.TruncateOutputBytes
+	}
+	return 0
+}
+
+func (x *HashConfig) GetHmac() bool {
+	if x != nil {
+		return x.Hmac
+	}
+	return false
+}
+
+func (x *HashConfig) GetNodePosition() NodePosition {
+	if x != nil {
+		return x.NodePosition
+	}
+	return NodePosition_NODEPOSITION_NONE
+}
+
 // ProgramMetadata provides metadata to verify and execute the hashmachine
 // program.
 type ProgramMetadata struct {
@@ -321,6 +637,35 @@ type ProgramMetadata struct {
 	// invalid. If the program does not use OPCODE_POP_CHILDREN_PUSH_HASH,
 	// then branching_factor is ignored.
 	BranchingFactor uint32 `protobuf:"varint,4,opt,name=branching_factor,json=branchingFactor,proto3" json:"branching_factor,omitempty"`
+	// expected_output_count is the number of byte strings the program
+	// produces as outputs. If expected_output_count is non-zero, each output
+	// must be matched exactly once by OPCODE_MATCH_OUTPUT and the stack must
+	// be empty when the program completes, otherwise the program is invalid.
+	//
+	// If expected_output_count is zero, the program's single output is the
+	// one value left on the stack when the program completes.
+	ExpectedOutputCount uint32 `protobuf:"varint,5,opt,name=expected_output_count,json=expectedOutputCount,proto3" json:"expected_output_count,omitempty"`
+	// hash_configs are additional hash configurations that individual ops can
+	// select with Op.hash_config, for proofs that cross hash domains (e.g. a
+	// leaf hashed with SHA-256 and included in a SHAKE-based log). Every
+	// config must be valid, whether or not an op selects it, otherwise the
+	// program is invalid.
+	HashConfigs []*HashConfig `protobuf:"bytes,6,rep,name=hash_configs,json=hashConfigs,proto3" json:"hash_configs,omitempty"`
+	// typed_stack, if set, tracks the type of each value on the stack: raw
+	// input, literal, leaf digest or node digest. Each opcode accepts only
+	// certain types; for example, tree node opcodes reject raw inputs that
+	// have not been hashed as leaves. A program that applies an opcode to a
+	// value of the wrong type is invalid.
+	TypedStack bool `protobuf:"varint,7,opt,name=typed_stack,json=typedStack,proto3" json:"typed_stack,omitempty"`
+	// strict, if set, requires every value pushed by OPCODE_PUSH_BYTES or
+	// OPCODE_PUSH_LITERAL and every input pushed by OPCODE_PUSH_INPUT to be
+	// exactly as long as the output of the hash function selected by the op.
+	// Inputs can still be hashed as leaves with OPCODE_PUSH_INPUT_HASHED. A
+	// program that pushes a value of any other length is invalid. In
+	// templates, OPCODE_PUSH_PARAM may only push PARAMTYPE_DIGEST parameters.
+	// OPCODE_CONCAT, OPCODE_PREPEND, OPCODE_APPEND and OPCODE_SLICE build
+	// values of other lengths, so strict programs cannot use them.
+	Strict bool `protobuf:"varint,8,opt,name=strict,proto3" json:"strict,omitempty"`
 }
 
 func (x *ProgramMetadata) Reset() {
@@ -376,6 +721,34 @@ func (x *ProgramMetadata) GetBranchingFactor() uint32 {
 	return 0
 }
 
+func (x *ProgramMetadata) GetExpectedOutputCount() uint32 {
+	if x != nil {
+		return x.ExpectedOutputCount
+	}
+	return 0
+}
+
+func (x *ProgramMetadata) GetHashConfigs() []*HashConfig {
+	if x != nil {
+		return x.HashConfigs
+	}
+	return nil
+}
+
+func (x *ProgramMetadata) GetTypedStack() bool {
+	if x != nil {
+		return x.TypedStack
+	}
+	return false
+}
+
+func (x *ProgramMetadata) GetStrict() bool {
+	if x != nil {
+		return x.Strict
+	}
+	return false
+}
+
 // Op represents a single operation in the hashmachine program. An Op can be
 // evaluated using its opcode and parameters as well as the current stack of
 // the hashmachine.
@@ -388,6 +761,11 @@ type Op struct {
 	// Parameters used by some opcodes
 	Index   uint64 `protobuf:"varint,2,opt,name=index,proto3" json:"index,omitempty"`
 	Payload []byte `protobuf:"bytes,3,opt,name=payload,proto3" json:"payload,omitempty"`
+	Length  uint64 `protobuf:"varint,4,opt,name=length,proto3" json:"length,omitempty"`
+	// hash_config selects the hash configuration used by a hashing op. Zero
+	// selects metadata.hash_config and n > 0 selects metadata.hash_configs[n-1].
+	// A program whose op selects a config that does not exist is invalid.
+	HashConfig uint32 `protobuf:"varint,5,opt,name=hash_config,json=hashConfig,proto3" json:"hash_config,omitempty"`
 }
 
 func (x *Op) Reset() {
@@ -443,6 +821,20 @@ func (x *Op) GetPayload() []byte {
 	return nil
 }
 
+func (x *Op) GetLength() uint64 {
+	if x != nil {
+		return x.Length
+	}
+	return 0
+}
+
+func (x *Op) GetHashConfig() uint32 {
+	if x != nil {
+		return x.HashConfig
+	}
+	return 0
+}
+
 type Program struct {
 	state         protoimpl.MessageState
 	sizeCache     protoimpl.SizeCache
@@ -450,6 +842,10 @@ type Program struct {
 
 	Metadata *ProgramMetadata `protobuf:"bytes,1,opt,name=metadata,proto3" json:"metadata,omitempty"`
 	Ops      []*Op            `protobuf:"bytes,2,rep,name=ops,proto3" json:"ops,omitempty"`
+	// literals are byte strings pushed by OPCODE_PUSH_LITERAL.
+	Literals [][]byte `protobuf:"bytes,3,rep,name=literals,proto3" json:"literals,omitempty"`
+	// subroutines are sequences of ops executed by OPCODE_CALL.
+	Subroutines []*Subroutine `protobuf:"bytes,4,rep,name=subroutines,proto3" json:"subroutines,omitempty"`
 }
 
 func (x *Program) Reset() {
@@ -498,9 +894,221 @@ func (x *Program) GetOps() []*Op {
 	return nil
 }
 
+func (x *Program) GetLiterals() [][]byte {
+	if x != nil {
+		return x.Literals
+	}
+	return nil
+}
+
+func (x *Program) GetSubroutines() []*Subroutine {
+	if x != nil {
+		return x.Subroutines
+	}
+	return nil
+}
+
+// Subroutine is a named sequence of ops that can be executed by OPCODE_CALL.
+// Subroutines have no parameters or flow control: each call behaves exactly as
+// though the subroutine's ops appeared in place of the call.
+type Subroutine struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	// name is informational only and does not affect execution.
+	Name string `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	Ops  []*Op  `protobuf:"bytes,2,rep,name=ops,proto3" json:"ops,omitempty"`
+}
+
+func (x *Subroutine) Reset() {
+	*x = Subroutine{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_hashmachine_proto_msgTypes[4]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *Subroutine) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Subroutine) ProtoMessage() {}
+
+func (x *Subroutine) ProtoReflect() protoreflect.Message {
+	mi := &file_hashmachine_proto_msgTypes[4]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Subroutine.ProtoReflect.Descriptor instead.
+func (*Subroutine) Descriptor() ([]byte, []int) {
+	return file_hashmachine_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *Subroutine) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *Subroutine) GetOps() []*Op {
+	if x != nil {
+		return x.Ops
+	}
+	return nil
+}
+
+// Template is a program with typed parameter slots, pushed by
+// OPCODE_PUSH_PARAM. A template captures the shape of a family of proofs; each
+// proof is an instantiation of the template with its own parameters.
+type Template struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Program *Program    `protobuf:"bytes,1,opt,name=program,proto3" json:"program,omitempty"`
+	Params  []ParamType `protobuf:"varint,2,rep,packed,name=params,proto3,enum=hashmachine.ParamType" json:"params,omitempty"`
+}
+
+func (x *Template) Reset() {
+	*x = Template{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_hashmachine_proto_msgTypes[5]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *Template) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Template) ProtoMessage() {}
+
+func (x *Template) ProtoReflect() protoreflect.Message {
+	mi := &file_hashmachine_proto_msgTypes[5]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Template.ProtoReflect.Descriptor instead.
+func (*Template) Descriptor() ([]byte, []int) {
+	return file_hashmachine_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *Template) GetProgram() *Program {
+	if x != nil {
+		return x.Program
+	}
+	return nil
+}
+
+func (x *Template) GetParams() []ParamType {
+	if x != nil {
+		return x.Params
+	}
+	return nil
+}
+
+// Proof is a self-contained claim that executing a program produces certain
+// outputs, typically the root hash of a log or tree. A Proof can be stored
+// next to the data it proves and verified by providing only the inputs.
+type Proof struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Program *Program `protobuf:"bytes,1,opt,name=program,proto3" json:"program,omitempty"`
+	// expected_outputs are the program's expected outputs: one output if the
+	// program's expected_output_count is zero, otherwise
+	// expected_output_count outputs.
+	ExpectedOutputs [][]byte `protobuf:"bytes,2,rep,name=expected_outputs,json=expectedOutputs,proto3" json:"expected_outputs,omitempty"`
+	// log_id optionally identifies the log the proof was made for, e.g. the
+	// origin line of the log's checkpoints.
+	LogId string `protobuf:"bytes,3,opt,name=log_id,json=logId,proto3" json:"log_id,omitempty"`
+	// tree_size optionally records the size of the tree the proof was made
+	// for.
+	TreeSize uint64 `protobuf:"varint,4,opt,name=tree_size,json=treeSize,proto3" json:"tree_size,omitempty"`
+}
+
+func (x *Proof) Reset() {
+	*x = Proof{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_hashmachine_proto_msgTypes[6]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *Proof) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Proof) ProtoMessage() {}
+
+func (x *Proof) ProtoReflect() protoreflect.Message {
+	mi := &file_hashmachine_proto_msgTypes[6]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Proof.ProtoReflect.Descriptor instead.
+func (*Proof) Descriptor() ([]byte, []int) {
+	return file_hashmachine_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *Proof) GetProgram() *Program {
+	if x != nil {
+		return x.Program
+	}
+	return nil
+}
+
+func (x *Proof) GetExpectedOutputs() [][]byte {
+	if x != nil {
+		return x.ExpectedOutputs
+	}
+	return nil
+}
+
+func (x *Proof) GetLogId() string {
+	if x != nil {
+		return x.LogId
+	}
+	return ""
+}
+
+func (x *Proof) GetTreeSize() uint64 {
+	if x != nil {
+		return x.TreeSize
+	}
+	return 0
+}
+
 var file_hashmachine_proto_extTypes = []protoimpl.ExtensionInfo{
 	{
-		ExtendedType:  (*descriptor.EnumValueOptions)(nil),
+		ExtendedType:  (*descriptorpb.EnumValueOptions)(nil),
 		ExtensionType: (*HashFunctionOutputLength)(nil),
 		Field:         54435,
 		Name:          "hashmachine.output_length",
@@ -509,7 +1117,7 @@ var file_hashmachine_proto_extTypes = []protoimpl.ExtensionInfo{
 	},
 }
 
-// Extension fields to descriptor.EnumValueOptions.
+// Extension fields to descriptorpb.EnumValueOptions.
 var (
 	// optional hashmachine.HashFunctionOutputLength output_length = 54435;
 	E_OutputLength = &file_hashmachine_proto_extTypes[0]
@@ -522,7 +1130,7 @@ var file_hashmachine_proto_rawDesc = []byte{
 	0x6f, 0x74, 0x6f, 0x12, 0x0b, 0x68, 0x61, 0x73, 0x68, 0x6d, 0x61, 0x63, 0x68, 0x69, 0x6e, 0x65,
 	0x1a, 0x20, 0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2f, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75,
 	0x66, 0x2f, 0x64, 0x65, 0x73, 0x63, 0x72, 0x69, 0x70, 0x74, 0x6f, 0x72, 0x2e, 0x70, 0x72, 0x6f,
-	0x74, 0x6f, 0x22, 0x85, 0x01, 0x0a, 0x0a, 0x48, 0x61, 0x73, 0x68, 0x43, 0x6f, 0x6e, 0x66, 0x69,
+	0x74, 0x6f, 0x22, 0x8d, 0x02, 0x0a, 0x0a, 0x48, 0x61, 0x73, 0x68, 0x43, 0x6f, 0x6e, 0x66, 0x69,
 	0x67, 0x12, 0x3e, 0x0a, 0x0d, 0x68, 0x61, 0x73, 0x68, 0x5f, 0x66, 0x75, 0x6e, 0x63, 0x74, 0x69,
 	0x6f, 0x6e, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0e, 0x32, 0x19, 0x2e, 0x68, 0x61, 0x73, 0x68, 0x6d,
 	0x61, 0x63, 0x68, 0x69, 0x6e, 0x65, 0x2e, 0x48, 0x61, 0x73, 0x68, 0x46, 0x75, 0x6e, 0x63, 0x74,
@@ -530,69 +1138,156 @@ var file_hashmachine_proto_rawDesc = []byte{
 	0x6e, 0x12, 0x37, 0x0a, 0x18, 0x68, 0x61, 0x73, 0x68, 0x5f, 0x6f, 0x75, 0x74, 0x70, 0x75, 0x74,
 	0x5f, 0x6c, 0x65, 0x6e, 0x67, 0x74, 0x68, 0x5f, 0x62, 0x79, 0x74, 0x65, 0x73, 0x18, 0x02, 0x20,
 	0x01, 0x28, 0x0d, 0x52, 0x15, 0x68, 0x61, 0x73, 0x68, 0x4f, 0x75, 0x74, 0x70, 0x75, 0x74, 0x4c,
-	0x65, 0x6e, 0x67, 0x74, 0x68, 0x42, 0x79, 0x74, 0x65, 0x73, 0x22, 0xa8, 0x01, 0x0a, 0x0f, 0x50,
-	0x72, 0x6f, 0x67, 0x72, 0x61, 0x6d, 0x4d, 0x65, 0x74, 0x61, 0x64, 0x61, 0x74, 0x61, 0x12, 0x38,
-	0x0a, 0x0b, 0x68, 0x61, 0x73, 0x68, 0x5f, 0x63, 0x6f, 0x6e, 0x66, 0x69, 0x67, 0x18, 0x01, 0x20,
-	0x01, 0x28, 0x0b, 0x32, 0x17, 0x2e, 0x68, 0x61, 0x73, 0x68, 0x6d, 0x61, 0x63, 0x68, 0x69, 0x6e,
-	0x65, 0x2e, 0x48, 0x61, 0x73, 0x68, 0x43, 0x6f, 0x6e, 0x66, 0x69, 0x67, 0x52, 0x0a, 0x68, 0x61,
-	0x73, 0x68, 0x43, 0x6f, 0x6e, 0x66, 0x69, 0x67, 0x12, 0x30, 0x0a, 0x14, 0x65, 0x78, 0x70, 0x65,
-	0x63, 0x74, 0x65, 0x64, 0x5f, 0x69, 0x6e, 0x70, 0x75, 0x74, 0x5f, 0x63, 0x6f, 0x75, 0x6e, 0x74,
-	0x18, 0x03, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x12, 0x65, 0x78, 0x70, 0x65, 0x63, 0x74, 0x65, 0x64,
-	0x49, 0x6e, 0x70, 0x75, 0x74, 0x43, 0x6f, 0x75, 0x6e, 0x74, 0x12, 0x29, 0x0a, 0x10, 0x62, 0x72,
-	0x61, 0x6e, 0x63, 0x68, 0x69, 0x6e, 0x67, 0x5f, 0x66, 0x61, 0x63, 0x74, 0x6f, 0x72, 0x18, 0x04,
-	0x20, 0x01, 0x28, 0x0d, 0x52, 0x0f, 0x62, 0x72, 0x61, 0x6e, 0x63, 0x68, 0x69, 0x6e, 0x67, 0x46,
-	0x61, 0x63, 0x74, 0x6f, 0x72, 0x22, 0x61, 0x0a, 0x02, 0x4f, 0x70, 0x12, 0x2b, 0x0a, 0x06, 0x6f,
-	0x70, 0x63, 0x6f, 0x64, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0e, 0x32, 0x13, 0x2e, 0x68, 0x61,
-	0x73, 0x68, 0x6d, 0x61, 0x63, 0x68, 0x69, 0x6e, 0x65, 0x2e, 0x4f, 0x70, 0x43, 0x6f, 0x64, 0x65,
-	0x52, 0x06, 0x6f, 0x70, 0x63, 0x6f, 0x64, 0x65, 0x12, 0x14, 0x0a, 0x05, 0x69, 0x6e, 0x64, 0x65,
-	0x78, 0x18, 0x02, 0x20, 0x01, 0x28, 0x04, 0x52, 0x05, 0x69, 0x6e, 0x64, 0x65, 0x78, 0x12, 0x18,
-	0x0a, 0x07, 0x70, 0x61, 0x79, 0x6c, 0x6f, 0x61, 0x64, 0x18, 0x03, 0x20, 0x01, 0x28, 0x0c, 0x52,
-	0x07, 0x70, 0x61, 0x79, 0x6c, 0x6f, 0x61, 0x64, 0x22, 0x66, 0x0a, 0x07, 0x50, 0x72, 0x6f, 0x67,
-	0x72, 0x61, 0x6d, 0x12, 0x38, 0x0a, 0x08, 0x6d, 0x65, 0x74, 0x61, 0x64, 0x61, 0x74, 0x61, 0x18,
-	0x01, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x1c, 0x2e, 0x68, 0x61, 0x73, 0x68, 0x6d, 0x61, 0x63, 0x68,
-	0x69, 0x6e, 0x65, 0x2e, 0x50, 0x72, 0x6f, 0x67, 0x72, 0x61, 0x6d, 0x4d, 0x65, 0x74, 0x61, 0x64,
-	0x61, 0x74, 0x61, 0x52, 0x08, 0x6d, 0x65, 0x74, 0x61, 0x64, 0x61, 0x74, 0x61, 0x12, 0x21, 0x0a,
-	0x03, 0x6f, 0x70, 0x73, 0x18, 0x02, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x0f, 0x2e, 0x68, 0x61, 0x73,
-	0x68, 0x6d, 0x61, 0x63, 0x68, 0x69, 0x6e, 0x65, 0x2e, 0x4f, 0x70, 0x52, 0x03, 0x6f, 0x70, 0x73,
-	0x2a, 0x8b, 0x01, 0x0a, 0x18, 0x48, 0x61, 0x73, 0x68, 0x46, 0x75, 0x6e, 0x63, 0x74, 0x69, 0x6f,
-	0x6e, 0x4f, 0x75, 0x74, 0x70, 0x75, 0x74, 0x4c, 0x65, 0x6e, 0x67, 0x74, 0x68, 0x12, 0x24, 0x0a,
-	0x20, 0x48, 0x41, 0x53, 0x48, 0x46, 0x55, 0x4e, 0x43, 0x54, 0x49, 0x4f, 0x4e, 0x4f, 0x55, 0x54,
-	0x50, 0x55, 0x54, 0x4c, 0x45, 0x4e, 0x47, 0x54, 0x48, 0x5f, 0x55, 0x4e, 0x4b, 0x4e, 0x4f, 0x57,
-	0x4e, 0x10, 0x00, 0x12, 0x22, 0x0a, 0x1e, 0x48, 0x41, 0x53, 0x48, 0x46, 0x55, 0x4e, 0x43, 0x54,
-	0x49, 0x4f, 0x4e, 0x4f, 0x55, 0x54, 0x50, 0x55, 0x54, 0x4c, 0x45, 0x4e, 0x47, 0x54, 0x48, 0x5f,
-	0x46, 0x49, 0x58, 0x45, 0x44, 0x10, 0x01, 0x12, 0x25, 0x0a, 0x21, 0x48, 0x41, 0x53, 0x48, 0x46,
-	0x55, 0x4e, 0x43, 0x54, 0x49, 0x4f, 0x4e, 0x4f, 0x55, 0x54, 0x50, 0x55, 0x54, 0x4c, 0x45, 0x4e,
-	0x47, 0x54, 0x48, 0x5f, 0x56, 0x41, 0x52, 0x49, 0x41, 0x42, 0x4c, 0x45, 0x10, 0x02, 0x2a, 0x69,
-	0x0a, 0x0c, 0x48, 0x61, 0x73, 0x68, 0x46, 0x75, 0x6e, 0x63, 0x74, 0x69, 0x6f, 0x6e, 0x12, 0x18,
-	0x0a, 0x14, 0x48, 0x41, 0x53, 0x48, 0x46, 0x55, 0x4e, 0x43, 0x54, 0x49, 0x4f, 0x4e, 0x5f, 0x55,
-	0x4e, 0x4b, 0x4e, 0x4f, 0x57, 0x4e, 0x10, 0x00, 0x12, 0x1e, 0x0a, 0x14, 0x48, 0x41, 0x53, 0x48,
-	0x46, 0x55, 0x4e, 0x43, 0x54, 0x49, 0x4f, 0x4e, 0x5f, 0x53, 0x48, 0x41, 0x5f, 0x32, 0x35, 0x36,
-	0x10, 0x01, 0x1a, 0x04, 0x98, 0xca, 0x1a, 0x01, 0x12, 0x1f, 0x0a, 0x15, 0x48, 0x41, 0x53, 0x48,
-	0x46, 0x55, 0x4e, 0x43, 0x54, 0x49, 0x4f, 0x4e, 0x5f, 0x53, 0x48, 0x41, 0x33, 0x5f, 0x35, 0x31,
-	0x32, 0x10, 0x02, 0x1a, 0x04, 0x98, 0xca, 0x1a, 0x02, 0x2a, 0xd2, 0x01, 0x0a, 0x06, 0x4f, 0x70,
-	0x43, 0x6f, 0x64, 0x65, 0x12, 0x12, 0x0a, 0x0e, 0x4f, 0x50, 0x43, 0x4f, 0x44, 0x45, 0x5f, 0x55,
-	0x4e, 0x4b, 0x4e, 0x4f, 0x57, 0x4e, 0x10, 0x00, 0x12, 0x12, 0x0a, 0x0e, 0x4f, 0x50, 0x43, 0x4f,
-	0x44, 0x45, 0x5f, 0x49, 0x4e, 0x56, 0x41, 0x4c, 0x49, 0x44, 0x10, 0x01, 0x12, 0x15, 0x0a, 0x11,
-	0x4f, 0x50, 0x43, 0x4f, 0x44, 0x45, 0x5f, 0x50, 0x55, 0x53, 0x48, 0x5f, 0x49, 0x4e, 0x50, 0x55,
-	0x54, 0x10, 0x02, 0x12, 0x15, 0x0a, 0x11, 0x4f, 0x50, 0x43, 0x4f, 0x44, 0x45, 0x5f, 0x50, 0x55,
-	0x53, 0x48, 0x5f, 0x42, 0x59, 0x54, 0x45, 0x53, 0x10, 0x03, 0x12, 0x21, 0x0a, 0x1d, 0x4f, 0x50,
-	0x43, 0x4f, 0x44, 0x45, 0x5f, 0x50, 0x4f, 0x50, 0x5f, 0x43, 0x48, 0x49, 0x4c, 0x44, 0x52, 0x45,
-	0x4e, 0x5f, 0x50, 0x55, 0x53, 0x48, 0x5f, 0x48, 0x41, 0x53, 0x48, 0x10, 0x04, 0x12, 0x1a, 0x0a,
-	0x16, 0x4f, 0x50, 0x43, 0x4f, 0x44, 0x45, 0x5f, 0x50, 0x4f, 0x50, 0x5f, 0x4e, 0x5f, 0x50, 0x55,
-	0x53, 0x48, 0x5f, 0x48, 0x41, 0x53, 0x48, 0x10, 0x05, 0x12, 0x1b, 0x0a, 0x17, 0x4f, 0x50, 0x43,
-	0x4f, 0x44, 0x45, 0x5f, 0x50, 0x45, 0x41, 0x4b, 0x5f, 0x4e, 0x5f, 0x50, 0x55, 0x53, 0x48, 0x5f,
-	0x48, 0x41, 0x53, 0x48, 0x10, 0x06, 0x12, 0x16, 0x0a, 0x12, 0x4f, 0x50, 0x43, 0x4f, 0x44, 0x45,
-	0x5f, 0x4d, 0x41, 0x54, 0x43, 0x48, 0x5f, 0x49, 0x4e, 0x50, 0x55, 0x54, 0x10, 0x07, 0x3a, 0x6f,
-	0x0a, 0x0d, 0x6f, 0x75, 0x74, 0x70, 0x75, 0x74, 0x5f, 0x6c, 0x65, 0x6e, 0x67, 0x74, 0x68, 0x12,
-	0x21, 0x2e, 0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75,
-	0x66, 0x2e, 0x45, 0x6e, 0x75, 0x6d, 0x56, 0x61, 0x6c, 0x75, 0x65, 0x4f, 0x70, 0x74, 0x69, 0x6f,
-	0x6e, 0x73, 0x18, 0xa3, 0xa9, 0x03, 0x20, 0x01, 0x28, 0x0e, 0x32, 0x25, 0x2e, 0x68, 0x61, 0x73,
-	0x68, 0x6d, 0x61, 0x63, 0x68, 0x69, 0x6e, 0x65, 0x2e, 0x48, 0x61, 0x73, 0x68, 0x46, 0x75, 0x6e,
-	0x63, 0x74, 0x69, 0x6f, 0x6e, 0x4f, 0x75, 0x74, 0x70, 0x75, 0x74, 0x4c, 0x65, 0x6e, 0x67, 0x74,
-	0x68, 0x52, 0x0c, 0x6f, 0x75, 0x74, 0x70, 0x75, 0x74, 0x4c, 0x65, 0x6e, 0x67, 0x74, 0x68, 0x42,
-	0x20, 0x5a, 0x1e, 0x67, 0x69, 0x74, 0x68, 0x75, 0x62, 0x2e, 0x63, 0x6f, 0x6d, 0x2f, 0x76, 0x73,
-	0x65, 0x6b, 0x68, 0x61, 0x72, 0x2f, 0x68, 0x61, 0x73, 0x68, 0x6d, 0x61, 0x63, 0x68, 0x69, 0x6e,
-	0x65, 0x62, 0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
+	0x65, 0x6e, 0x67, 0x74, 0x68, 0x42, 0x79, 0x74, 0x65, 0x73, 0x12, 0x32, 0x0a, 0x15, 0x74, 0x72,
+	0x75, 0x6e, 0x63, 0x61, 0x74, 0x65, 0x5f, 0x6f, 0x75, 0x74, 0x70, 0x75, 0x74, 0x5f, 0x62, 0x79,
+	0x74, 0x65, 0x73, 0x18, 0x03, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x13, 0x74, 0x72, 0x75, 0x6e, 0x63,
+	0x61, 0x74, 0x65, 0x4f, 0x75, 0x74, 0x70, 0x75, 0x74, 0x42, 0x79, 0x74, 0x65, 0x73, 0x12, 0x12,
+	0x0a, 0x04, 0x68, 0x6d, 0x61, 0x63, 0x18, 0x04, 0x20, 0x01, 0x28, 0x08, 0x52, 0x04, 0x68, 0x6d,
+	0x61, 0x63, 0x12, 0x3e, 0x0a, 0x0d, 0x6e, 0x6f, 0x64, 0x65, 0x5f, 0x70, 0x6f, 0x73, 0x69, 0x74,
+	0x69, 0x6f, 0x6e, 0x18, 0x05, 0x20, 0x01, 0x28, 0x0e, 0x32, 0x19, 0x2e, 0x68, 0x61, 0x73, 0x68,
+	0x6d, 0x61, 0x63, 0x68, 0x69, 0x6e, 0x65, 0x2e, 0x4e, 0x6f, 0x64, 0x65, 0x50, 0x6f, 0x73, 0x69,
+	0x74, 0x69, 0x6f, 0x6e, 0x52, 0x0c, 0x6e, 0x6f, 0x64, 0x65, 0x50, 0x6f, 0x73, 0x69, 0x74, 0x69,
+	0x6f, 0x6e, 0x22, 0xd1, 0x02, 0x0a, 0x0f, 0x50, 0x72, 0x6f, 0x67, 0x72, 0x61, 0x6d, 0x4d, 0x65,
+	0x74, 0x61, 0x64, 0x61, 0x74, 0x61, 0x12, 0x38, 0x0a, 0x0b, 0x68, 0x61, 0x73, 0x68, 0x5f, 0x63,
+	0x6f, 0x6e, 0x66, 0x69, 0x67, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x17, 0x2e, 0x68, 0x61,
+	0x73, 0x68, 0x6d, 0x61, 0x63, 0x68, 0x69, 0x6e, 0x65, 0x2e, 0x48, 0x61, 0x73, 0x68, 0x43, 0x6f,
+	0x6e, 0x66, 0x69, 0x67, 0x52, 0x0a, 0x68, 0x61, 0x73, 0x68, 0x43, 0x6f, 0x6e, 0x66, 0x69, 0x67,
+	0x12, 0x30, 0x0a, 0x14, 0x65, 0x78, 0x70, 0x65, 0x63, 0x74, 0x65, 0x64, 0x5f, 0x69, 0x6e, 0x70,
+	0x75, 0x74, 0x5f, 0x63, 0x6f, 0x75, 0x6e, 0x74, 0x18, 0x03, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x12,
+	0x65, 0x78, 0x70, 0x65, 0x63, 0x74, 0x65, 0x64, 0x49, 0x6e, 0x70, 0x75, 0x74, 0x43, 0x6f, 0x75,
+	0x6e, 0x74, 0x12, 0x29, 0x0a, 0x10, 0x62, 0x72, 0x61, 0x6e, 0x63, 0x68, 0x69, 0x6e, 0x67, 0x5f,
+	0x66, 0x61, 0x63, 0x74, 0x6f, 0x72, 0x18, 0x04, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x0f, 0x62, 0x72,
+	0x61, 0x6e, 0x63, 0x68, 0x69, 0x6e, 0x67, 0x46, 0x61, 0x63, 0x74, 0x6f, 0x72, 0x12, 0x32, 0x0a,
+	0x15, 0x65, 0x78, 0x70, 0x65, 0x63, 0x74, 0x65, 0x64, 0x5f, 0x6f, 0x75, 0x74, 0x70, 0x75, 0x74,
+	0x5f, 0x63, 0x6f, 0x75, 0x6e, 0x74, 0x18, 0x05, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x13, 0x65, 0x78,
+	0x70, 0x65, 0x63, 0x74, 0x65, 0x64, 0x4f, 0x75, 0x74, 0x70, 0x75, 0x74, 0x43, 0x6f, 0x75, 0x6e,
+	0x74, 0x12, 0x3a, 0x0a, 0x0c, 0x68, 0x61, 0x73, 0x68, 0x5f, 0x63, 0x6f, 0x6e, 0x66, 0x69, 0x67,
+	0x73, 0x18, 0x06, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x17, 0x2e, 0x68, 0x61, 0x73, 0x68, 0x6d, 0x61,
+	0x63, 0x68, 0x69, 0x6e, 0x65, 0x2e, 0x48, 0x61, 0x73, 0x68, 0x43, 0x6f, 0x6e, 0x66, 0x69, 0x67,
+	0x52, 0x0b, 0x68, 0x61, 0x73, 0x68, 0x43, 0x6f, 0x6e, 0x66, 0x69, 0x67, 0x73, 0x12, 0x1f, 0x0a,
+	0x0b, 0x74, 0x79, 0x70, 0x65, 0x64, 0x5f, 0x73, 0x74, 0x61, 0x63, 0x6b, 0x18, 0x07, 0x20, 0x01,
+	0x28, 0x08, 0x52, 0x0a, 0x74, 0x79, 0x70, 0x65, 0x64, 0x53, 0x74, 0x61, 0x63, 0x6b, 0x12, 0x16,
+	0x0a, 0x06, 0x73, 0x74, 0x72, 0x69, 0x63, 0x74, 0x18, 0x08, 0x20, 0x01, 0x28, 0x08, 0x52, 0x06,
+	0x73, 0x74, 0x72, 0x69, 0x63, 0x74, 0x22, 0x9a, 0x01, 0x0a, 0x02, 0x4f, 0x70, 0x12, 0x2b, 0x0a,
+	0x06, 0x6f, 0x70, 0x63, 0x6f, 0x64, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0e, 0x32, 0x13, 0x2e,
+	0x68, 0x61, 0x73, 0x68, 0x6d, 0x61, 0x63, 0x68, 0x69, 0x6e, 0x65, 0x2e, 0x4f, 0x70, 0x43, 0x6f,
+	0x64, 0x65, 0x52, 0x06, 0x6f, 0x70, 0x63, 0x6f, 0x64, 0x65, 0x12, 0x14, 0x0a, 0x05, 0x69, 0x6e,
+	0x64, 0x65, 0x78, 0x18, 0x02, 0x20, 0x01, 0x28, 0x04, 0x52, 0x05, 0x69, 0x6e, 0x64, 0x65, 0x78,
+	0x12, 0x18, 0x0a, 0x07, 0x70, 0x61, 0x79, 0x6c, 0x6f, 0x61, 0x64, 0x18, 0x03, 0x20, 0x01, 0x28,
+	0x0c, 0x52, 0x07, 0x70, 0x61, 0x79, 0x6c, 0x6f, 0x61, 0x64, 0x12, 0x16, 0x0a, 0x06, 0x6c, 0x65,
+	0x6e, 0x67, 0x74, 0x68, 0x18, 0x04, 0x20, 0x01, 0x28, 0x04, 0x52, 0x06, 0x6c, 0x65, 0x6e, 0x67,
+	0x74, 0x68, 0x12, 0x1f, 0x0a, 0x0b, 0x68, 0x61, 0x73, 0x68, 0x5f, 0x63, 0x6f, 0x6e, 0x66, 0x69,
+	0x67, 0x18, 0x05, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x0a, 0x68, 0x61, 0x73, 0x68, 0x43, 0x6f, 0x6e,
+	0x66, 0x69, 0x67, 0x22, 0xbd, 0x01, 0x0a, 0x07, 0x50, 0x72, 0x6f, 0x67, 0x72, 0x61, 0x6d, 0x12,
+	0x38, 0x0a, 0x08, 0x6d, 0x65, 0x74, 0x61, 0x64, 0x61, 0x74, 0x61, 0x18, 0x01, 0x20, 0x01, 0x28,
+	0x0b, 0x32, 0x1c, 0x2e, 0x68, 0x61, 0x73, 0x68, 0x6d, 0x61, 0x63, 0x68, 0x69, 0x6e, 0x65, 0x2e,
+	0x50, 0x72, 0x6f, 0x67, 0x72, 0x61, 0x6d, 0x4d, 0x65, 0x74, 0x61, 0x64, 0x61, 0x74, 0x61, 0x52,
+	0x08, 0x6d, 0x65, 0x74, 0x61, 0x64, 0x61, 0x74, 0x61, 0x12, 0x21, 0x0a, 0x03, 0x6f, 0x70, 0x73,
+	0x18, 0x02, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x0f, 0x2e, 0x68, 0x61, 0x73, 0x68, 0x6d, 0x61, 0x63,
+	0x68, 0x69, 0x6e, 0x65, 0x2e, 0x4f, 0x70, 0x52, 0x03, 0x6f, 0x70, 0x73, 0x12, 0x1a, 0x0a, 0x08,
+	0x6c, 0x69, 0x74, 0x65, 0x72, 0x61, 0x6c, 0x73, 0x18, 0x03, 0x20, 0x03, 0x28, 0x0c, 0x52, 0x08,
+	0x6c, 0x69, 0x74, 0x65, 0x72, 0x61, 0x6c, 0x73, 0x12, 0x39, 0x0a, 0x0b, 0x73, 0x75, 0x62, 0x72,
+	0x6f, 0x75, 0x74, 0x69, 0x6e, 0x65, 0x73, 0x18, 0x04, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x17, 0x2e,
+	0x68, 0x61, 0x73, 0x68, 0x6d, 0x61, 0x63, 0x68, 0x69, 0x6e, 0x65, 0x2e, 0x53, 0x75, 0x62, 0x72,
+	0x6f, 0x75, 0x74, 0x69, 0x6e, 0x65, 0x52, 0x0b, 0x73, 0x75, 0x62, 0x72, 0x6f, 0x75, 0x74, 0x69,
+	0x6e, 0x65, 0x73, 0x22, 0x43, 0x0a, 0x0a, 0x53, 0x75, 0x62, 0x72, 0x6f, 0x75, 0x74, 0x69, 0x6e,
+	0x65, 0x12, 0x12, 0x0a, 0x04, 0x6e, 0x61, 0x6d, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52,
+	0x04, 0x6e, 0x61, 0x6d, 0x65, 0x12, 0x21, 0x0a, 0x03, 0x6f, 0x70, 0x73, 0x18, 0x02, 0x20, 0x03,
+	0x28, 0x0b, 0x32, 0x0f, 0x2e, 0x68, 0x61, 0x73, 0x68, 0x6d, 0x61, 0x63, 0x68, 0x69, 0x6e, 0x65,
+	0x2e, 0x4f, 0x70, 0x52, 0x03, 0x6f, 0x70, 0x73, 0x22, 0x6a, 0x0a, 0x08, 0x54, 0x65, 0x6d, 0x70,
+	0x6c, 0x61, 0x74, 0x65, 0x12, 0x2e, 0x0a, 0x07, 0x70, 0x72, 0x6f, 0x67, 0x72, 0x61, 0x6d, 0x18,
+	0x01, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x14, 0x2e, 0x68, 0x61, 0x73, 0x68, 0x6d, 0x61, 0x63, 0x68,
+	0x69, 0x6e, 0x65, 0x2e, 0x50, 0x72, 0x6f, 0x67, 0x72, 0x61, 0x6d, 0x52, 0x07, 0x70, 0x72, 0x6f,
+	0x67, 0x72, 0x61, 0x6d, 0x12, 0x2e, 0x0a, 0x06, 0x70, 0x61, 0x72, 0x61, 0x6d, 0x73, 0x18, 0x02,
+	0x20, 0x03, 0x28, 0x0e, 0x32, 0x16, 0x2e, 0x68, 0x61, 0x73, 0x68, 0x6d, 0x61, 0x63, 0x68, 0x69,
+	0x6e, 0x65, 0x2e, 0x50, 0x61, 0x72, 0x61, 0x6d, 0x54, 0x79, 0x70, 0x65, 0x52, 0x06, 0x70, 0x61,
+	0x72, 0x61, 0x6d, 0x73, 0x22, 0x96, 0x01, 0x0a, 0x05, 0x50, 0x72, 0x6f, 0x6f, 0x66, 0x12, 0x2e,
+	0x0a, 0x07, 0x70, 0x72, 0x6f, 0x67, 0x72, 0x61, 0x6d, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0b, 0x32,
+	0x14, 0x2e, 0x68, 0x61, 0x73, 0x68, 0x6d, 0x61, 0x63, 0x68, 0x69, 0x6e, 0x65, 0x2e, 0x50, 0x72,
+	0x6f, 0x67, 0x72, 0x61, 0x6d, 0x52, 0x07, 0x70, 0x72, 0x6f, 0x67, 0x72, 0x61, 0x6d, 0x12, 0x29,
+	0x0a, 0x10, 0x65, 0x78, 0x70, 0x65, 0x63, 0x74, 0x65, 0x64, 0x5f, 0x6f, 0x75, 0x74, 0x70, 0x75,
+	0x74, 0x73, 0x18, 0x02, 0x20, 0x03, 0x28, 0x0c, 0x52, 0x0f, 0x65, 0x78, 0x70, 0x65, 0x63, 0x74,
+	0x65, 0x64, 0x4f, 0x75, 0x74, 0x70, 0x75, 0x74, 0x73, 0x12, 0x15, 0x0a, 0x06, 0x6c, 0x6f, 0x67,
+	0x5f, 0x69, 0x64, 0x18, 0x03, 0x20, 0x01, 0x28, 0x09, 0x52, 0x05, 0x6c, 0x6f, 0x67, 0x49, 0x64,
+	0x12, 0x1b, 0x0a, 0x09, 0x74, 0x72, 0x65, 0x65, 0x5f, 0x73, 0x69, 0x7a, 0x65, 0x18, 0x04, 0x20,
+	0x01, 0x28, 0x04, 0x52, 0x08, 0x74, 0x72, 0x65, 0x65, 0x53, 0x69, 0x7a, 0x65, 0x2a, 0x8b, 0x01,
+	0x0a, 0x18, 0x48, 0x61, 0x73, 0x68, 0x46, 0x75, 0x6e, 0x63, 0x74, 0x69, 0x6f, 0x6e, 0x4f, 0x75,
+	0x74, 0x70, 0x75, 0x74, 0x4c, 0x65, 0x6e, 0x67, 0x74, 0x68, 0x12, 0x24, 0x0a, 0x20, 0x48, 0x41,
+	0x53, 0x48, 0x46, 0x55, 0x4e, 0x43, 0x54, 0x49, 0x4f, 0x4e, 0x4f, 0x55, 0x54, 0x50, 0x55, 0x54,
+	0x4c, 0x45, 0x4e, 0x47, 0x54, 0x48, 0x5f, 0x55, 0x4e, 0x4b, 0x4e, 0x4f, 0x57, 0x4e, 0x10, 0x00,
+	0x12, 0x22, 0x0a, 0x1e, 0x48, 0x41, 0x53, 0x48, 0x46, 0x55, 0x4e, 0x43, 0x54, 0x49, 0x4f, 0x4e,
+	0x4f, 0x55, 0x54, 0x50, 0x55, 0x54, 0x4c, 0x45, 0x4e, 0x47, 0x54, 0x48, 0x5f, 0x46, 0x49, 0x58,
+	0x45, 0x44, 0x10, 0x01, 0x12, 0x25, 0x0a, 0x21, 0x48, 0x41, 0x53, 0x48, 0x46, 0x55, 0x4e, 0x43,
+	0x54, 0x49, 0x4f, 0x4e, 0x4f, 0x55, 0x54, 0x50, 0x55, 0x54, 0x4c, 0x45, 0x4e, 0x47, 0x54, 0x48,
+	0x5f, 0x56, 0x41, 0x52, 0x49, 0x41, 0x42, 0x4c, 0x45, 0x10, 0x02, 0x2a, 0x8a, 0x01, 0x0a, 0x0c,
+	0x48, 0x61, 0x73, 0x68, 0x46, 0x75, 0x6e, 0x63, 0x74, 0x69, 0x6f, 0x6e, 0x12, 0x18, 0x0a, 0x14,
+	0x48, 0x41, 0x53, 0x48, 0x46, 0x55, 0x4e, 0x43, 0x54, 0x49, 0x4f, 0x4e, 0x5f, 0x55, 0x4e, 0x4b,
+	0x4e, 0x4f, 0x57, 0x4e, 0x10, 0x00, 0x12, 0x1e, 0x0a, 0x14, 0x48, 0x41, 0x53, 0x48, 0x46, 0x55,
+	0x4e, 0x43, 0x54, 0x49, 0x4f, 0x4e, 0x5f, 0x53, 0x48, 0x41, 0x5f, 0x32, 0x35, 0x36, 0x10, 0x01,
+	0x1a, 0x04, 0x98, 0xca, 0x1a, 0x01, 0x12, 0x1f, 0x0a, 0x15, 0x48, 0x41, 0x53, 0x48, 0x46, 0x55,
+	0x4e, 0x43, 0x54, 0x49, 0x4f, 0x4e, 0x5f, 0x53, 0x48, 0x41, 0x33, 0x5f, 0x35, 0x31, 0x32, 0x10,
+	0x02, 0x1a, 0x04, 0x98, 0xca, 0x1a, 0x02, 0x12, 0x1f, 0x0a, 0x15, 0x48, 0x41, 0x53, 0x48, 0x46,
+	0x55, 0x4e, 0x43, 0x54, 0x49, 0x4f, 0x4e, 0x5f, 0x53, 0x48, 0x41, 0x5f, 0x32, 0x35, 0x36, 0x44,
+	0x10, 0x03, 0x1a, 0x04, 0x98, 0xca, 0x1a, 0x01, 0x2a, 0x56, 0x0a, 0x0c, 0x4e, 0x6f, 0x64, 0x65,
+	0x50, 0x6f, 0x73, 0x69, 0x74, 0x69, 0x6f, 0x6e, 0x12, 0x15, 0x0a, 0x11, 0x4e, 0x4f, 0x44, 0x45,
+	0x50, 0x4f, 0x53, 0x49, 0x54, 0x49, 0x4f, 0x4e, 0x5f, 0x4e, 0x4f, 0x4e, 0x45, 0x10, 0x00, 0x12,
+	0x17, 0x0a, 0x13, 0x4e, 0x4f, 0x44, 0x45, 0x50, 0x4f, 0x53, 0x49, 0x54, 0x49, 0x4f, 0x4e, 0x5f,
+	0x48, 0x45, 0x49, 0x47, 0x48, 0x54, 0x10, 0x01, 0x12, 0x16, 0x0a, 0x12, 0x4e, 0x4f, 0x44, 0x45,
+	0x50, 0x4f, 0x53, 0x49, 0x54, 0x49, 0x4f, 0x4e, 0x5f, 0x49, 0x4e, 0x44, 0x45, 0x58, 0x10, 0x02,
+	0x2a, 0xe6, 0x04, 0x0a, 0x06, 0x4f, 0x70, 0x43, 0x6f, 0x64, 0x65, 0x12, 0x12, 0x0a, 0x0e, 0x4f,
+	0x50, 0x43, 0x4f, 0x44, 0x45, 0x5f, 0x55, 0x4e, 0x4b, 0x4e, 0x4f, 0x57, 0x4e, 0x10, 0x00, 0x12,
+	0x12, 0x0a, 0x0e, 0x4f, 0x50, 0x43, 0x4f, 0x44, 0x45, 0x5f, 0x49, 0x4e, 0x56, 0x41, 0x4c, 0x49,
+	0x44, 0x10, 0x01, 0x12, 0x15, 0x0a, 0x11, 0x4f, 0x50, 0x43, 0x4f, 0x44, 0x45, 0x5f, 0x50, 0x55,
+	0x53, 0x48, 0x5f, 0x49, 0x4e, 0x50, 0x55, 0x54, 0x10, 0x02, 0x12, 0x15, 0x0a, 0x11, 0x4f, 0x50,
+	0x43, 0x4f, 0x44, 0x45, 0x5f, 0x50, 0x55, 0x53, 0x48, 0x5f, 0x42, 0x59, 0x54, 0x45, 0x53, 0x10,
+	0x03, 0x12, 0x21, 0x0a, 0x1d, 0x4f, 0x50, 0x43, 0x4f, 0x44, 0x45, 0x5f, 0x50, 0x4f, 0x50, 0x5f,
+	0x43, 0x48, 0x49, 0x4c, 0x44, 0x52, 0x45, 0x4e, 0x5f, 0x50, 0x55, 0x53, 0x48, 0x5f, 0x48, 0x41,
+	0x53, 0x48, 0x10, 0x04, 0x12, 0x1a, 0x0a, 0x16, 0x4f, 0x50, 0x43, 0x4f, 0x44, 0x45, 0x5f, 0x50,
+	0x4f, 0x50, 0x5f, 0x4e, 0x5f, 0x50, 0x55, 0x53, 0x48, 0x5f, 0x48, 0x41, 0x53, 0x48, 0x10, 0x05,
+	0x12, 0x1b, 0x0a, 0x17, 0x4f, 0x50, 0x43, 0x4f, 0x44, 0x45, 0x5f, 0x50, 0x45, 0x41, 0x4b, 0x5f,
+	0x4e, 0x5f, 0x50, 0x55, 0x53, 0x48, 0x5f, 0x48, 0x41, 0x53, 0x48, 0x10, 0x06, 0x12, 0x16, 0x0a,
+	0x12, 0x4f, 0x50, 0x43, 0x4f, 0x44, 0x45, 0x5f, 0x4d, 0x41, 0x54, 0x43, 0x48, 0x5f, 0x49, 0x4e,
+	0x50, 0x55, 0x54, 0x10, 0x07, 0x12, 0x1c, 0x0a, 0x18, 0x4f, 0x50, 0x43, 0x4f, 0x44, 0x45, 0x5f,
+	0x50, 0x55, 0x53, 0x48, 0x5f, 0x49, 0x4e, 0x50, 0x55, 0x54, 0x5f, 0x48, 0x41, 0x53, 0x48, 0x45,
+	0x44, 0x10, 0x08, 0x12, 0x17, 0x0a, 0x13, 0x4f, 0x50, 0x43, 0x4f, 0x44, 0x45, 0x5f, 0x4d, 0x41,
+	0x54, 0x43, 0x48, 0x5f, 0x4f, 0x55, 0x54, 0x50, 0x55, 0x54, 0x10, 0x09, 0x12, 0x2a, 0x0a, 0x26,
+	0x4f, 0x50, 0x43, 0x4f, 0x44, 0x45, 0x5f, 0x50, 0x4f, 0x50, 0x5f, 0x43, 0x48, 0x49, 0x4c, 0x44,
+	0x52, 0x45, 0x4e, 0x5f, 0x41, 0x4e, 0x44, 0x5f, 0x44, 0x41, 0x54, 0x41, 0x5f, 0x50, 0x55, 0x53,
+	0x48, 0x5f, 0x48, 0x41, 0x53, 0x48, 0x10, 0x0a, 0x12, 0x16, 0x0a, 0x12, 0x4f, 0x50, 0x43, 0x4f,
+	0x44, 0x45, 0x5f, 0x4d, 0x41, 0x54, 0x43, 0x48, 0x5f, 0x42, 0x59, 0x54, 0x45, 0x53, 0x10, 0x0b,
+	0x12, 0x11, 0x0a, 0x0d, 0x4f, 0x50, 0x43, 0x4f, 0x44, 0x45, 0x5f, 0x43, 0x4f, 0x4e, 0x43, 0x41,
+	0x54, 0x10, 0x0c, 0x12, 0x12, 0x0a, 0x0e, 0x4f, 0x50, 0x43, 0x4f, 0x44, 0x45, 0x5f, 0x50, 0x52,
+	0x45, 0x50, 0x45, 0x4e, 0x44, 0x10, 0x0d, 0x12, 0x11, 0x0a, 0x0d, 0x4f, 0x50, 0x43, 0x4f, 0x44,
+	0x45, 0x5f, 0x41, 0x50, 0x50, 0x45, 0x4e, 0x44, 0x10, 0x0e, 0x12, 0x10, 0x0a, 0x0c, 0x4f, 0x50,
+	0x43, 0x4f, 0x44, 0x45, 0x5f, 0x53, 0x4c, 0x49, 0x43, 0x45, 0x10, 0x0f, 0x12, 0x0e, 0x0a, 0x0a,
+	0x4f, 0x50, 0x43, 0x4f, 0x44, 0x45, 0x5f, 0x44, 0x55, 0x50, 0x10, 0x10, 0x12, 0x0f, 0x0a, 0x0b,
+	0x4f, 0x50, 0x43, 0x4f, 0x44, 0x45, 0x5f, 0x53, 0x57, 0x41, 0x50, 0x10, 0x11, 0x12, 0x0e, 0x0a,
+	0x0a, 0x4f, 0x50, 0x43, 0x4f, 0x44, 0x45, 0x5f, 0x52, 0x4f, 0x54, 0x10, 0x12, 0x12, 0x0f, 0x0a,
+	0x0b, 0x4f, 0x50, 0x43, 0x4f, 0x44, 0x45, 0x5f, 0x44, 0x52, 0x4f, 0x50, 0x10, 0x13, 0x12, 0x28,
+	0x0a, 0x24, 0x4f, 0x50, 0x43, 0x4f, 0x44, 0x45, 0x5f, 0x50, 0x4f, 0x50, 0x5f, 0x53, 0x4f, 0x52,
+	0x54, 0x45, 0x44, 0x5f, 0x43, 0x48, 0x49, 0x4c, 0x44, 0x52, 0x45, 0x4e, 0x5f, 0x50, 0x55, 0x53,
+	0x48, 0x5f, 0x48, 0x41, 0x53, 0x48, 0x10, 0x14, 0x12, 0x16, 0x0a, 0x12, 0x4f, 0x50, 0x43, 0x4f,
+	0x44, 0x45, 0x5f, 0x52, 0x45, 0x50, 0x45, 0x41, 0x54, 0x5f, 0x48, 0x41, 0x53, 0x48, 0x10, 0x15,
+	0x12, 0x17, 0x0a, 0x13, 0x4f, 0x50, 0x43, 0x4f, 0x44, 0x45, 0x5f, 0x50, 0x55, 0x53, 0x48, 0x5f,
+	0x4c, 0x49, 0x54, 0x45, 0x52, 0x41, 0x4c, 0x10, 0x16, 0x12, 0x0f, 0x0a, 0x0b, 0x4f, 0x50, 0x43,
+	0x4f, 0x44, 0x45, 0x5f, 0x43, 0x41, 0x4c, 0x4c, 0x10, 0x17, 0x12, 0x15, 0x0a, 0x11, 0x4f, 0x50,
+	0x43, 0x4f, 0x44, 0x45, 0x5f, 0x50, 0x55, 0x53, 0x48, 0x5f, 0x50, 0x41, 0x52, 0x41, 0x4d, 0x10,
+	0x18, 0x22, 0x06, 0x08, 0xe8, 0x07, 0x10, 0xcf, 0x0f, 0x2a, 0x4d, 0x0a, 0x09, 0x50, 0x61, 0x72,
+	0x61, 0x6d, 0x54, 0x79, 0x70, 0x65, 0x12, 0x15, 0x0a, 0x11, 0x50, 0x41, 0x52, 0x41, 0x4d, 0x54,
+	0x59, 0x50, 0x45, 0x5f, 0x55, 0x4e, 0x4b, 0x4e, 0x4f, 0x57, 0x4e, 0x10, 0x00, 0x12, 0x13, 0x0a,
+	0x0f, 0x50, 0x41, 0x52, 0x41, 0x4d, 0x54, 0x59, 0x50, 0x45, 0x5f, 0x42, 0x59, 0x54, 0x45, 0x53,
+	0x10, 0x01, 0x12, 0x14, 0x0a, 0x10, 0x50, 0x41, 0x52, 0x41, 0x4d, 0x54, 0x59, 0x50, 0x45, 0x5f,
+	0x44, 0x49, 0x47, 0x45, 0x53, 0x54, 0x10, 0x02, 0x3a, 0x6f, 0x0a, 0x0d, 0x6f, 0x75, 0x74, 0x70,
+	0x75, 0x74, 0x5f, 0x6c, 0x65, 0x6e, 0x67, 0x74, 0x68, 0x12, 0x21, 0x2e, 0x67, 0x6f, 0x6f, 0x67,
+	0x6c, 0x65, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66, 0x2e, 0x45, 0x6e, 0x75, 0x6d,
+	0x56, 0x61, 0x6c, 0x75, 0x65, 0x4f, 0x70, 0x74, 0x69, 0x6f, 0x6e, 0x73, 0x18, 0xa3, 0xa9, 0x03,
+	0x20, 0x01, 0x28, 0x0e, 0x32, 0x25, 0x2e, 0x68, 0x61, 0x73, 0x68, 0x6d, 0x61, 0x63, 0x68, 0x69,
+	0x6e, 0x65, 0x2e, 0x48, 0x61, 0x73, 0x68, 0x46, 0x75, 0x6e, 0x63, 0x74, 0x69, 0x6f, 0x6e, 0x4f,
+	0x75, 0x74, 0x70, 0x75, 0x74, 0x4c, 0x65, 0x6e, 0x67, 0x74, 0x68, 0x52, 0x0c, 0x6f, 0x75, 0x74,
+	0x70, 0x75, 0x74, 0x4c, 0x65, 0x6e, 0x67, 0x74, 0x68, 0x42, 0x20, 0x5a, 0x1e, 0x67, 0x69, 0x74,
+	0x68, 0x75, 0x62, 0x2e, 0x63, 0x6f, 0x6d, 0x2f, 0x76, 0x73, 0x65, 0x6b, 0x68, 0x61, 0x72, 0x2f,
+	0x68, 0x61, 0x73, 0x68, 0x6d, 0x61, 0x63, 0x68, 0x69, 0x6e, 0x65, 0x62, 0x06, 0x70, 0x72, 0x6f,
+	0x74, 0x6f, 0x33,
 }
 
 var (
@@ -607,31 +1302,43 @@ func file_hashmachine_proto_rawDescGZIP() []byte {
 	return file_hashmachine_proto_rawDescData
 }
 
-var file_hashmachine_proto_enumTypes = make([]protoimpl.EnumInfo, 3)
-var file_hashmachine_proto_msgTypes = make([]protoimpl.MessageInfo, 4)
+var file_hashmachine_proto_enumTypes = make([]protoimpl.EnumInfo, 5)
+var file_hashmachine_proto_msgTypes = make([]protoimpl.MessageInfo, 7)
 var file_hashmachine_proto_goTypes = []interface{}{
-	(HashFunctionOutputLength)(0),       // 0: hashmachine.HashFunctionOutputLength
-	(HashFunction)(0),                   // 1: hashmachine.HashFunction
-	(OpCode)(0),                         // 2: hashmachine.OpCode
-	(*HashConfig)(nil),                  // 3: hashmachine.HashConfig
-	(*ProgramMetadata)(nil),             // 4: hashmachine.ProgramMetadata
-	(*Op)(nil),                          // 5: hashmachine.Op
-	(*Program)(nil),                     // 6: hashmachine.Program
-	(*descriptor.EnumValueOptions)(nil), // 7: google.protobuf.EnumValueOptions
+	(HashFunctionOutputLength)(0),         // 0: hashmachine.HashFunctionOutputLength
+	(HashFunction)(0),                     // 1: hashmachine.HashFunction
+	(NodePosition)(0),                     // 2: hashmachine.NodePosition
+	(OpCode)(0),                           // 3: hashmachine.OpCode
+	(ParamType)(0),                        // 4: hashmachine.ParamType
+	(*HashConfig)(nil),                    // 5: hashmachine.HashConfig
+	(*ProgramMetadata)(nil),               // 6: hashmachine.ProgramMetadata
+	(*Op)(nil),                            // 7: hashmachine.Op
+	(*Program)(nil),                       // 8: hashmachine.Program
+	(*Subroutine)(nil),                    // 9: hashmachine.Subroutine
+	(*Template)(nil),                      // 10: hashmachine.Template
+	(*Proof)(nil),                         // 11: hashmachine.Proof
+	(*descriptorpb.EnumValueOptions)(nil), // 12: google.protobuf.EnumValueOptions
 }
 var file_hashmachine_proto_depIdxs = []int32{
-	1, // 0: hashmachine.HashConfig.hash_function:type_name -> hashmachine.HashFunction
-	3, // 1: hashmachine.ProgramMetadata.hash_config:type_name -> hashmachine.HashConfig
-	2, // 2: hashmachine.Op.opcode:type_name -> hashmachine.OpCode
-	4, // 3: hashmachine.Program.metadata:type_name -> hashmachine.ProgramMetadata
-	5, // 4: hashmachine.Program.ops:type_name -> hashmachine.Op
-	7, // 5: hashmachine.output_length:extendee -> google.protobuf.EnumValueOptions
-	0, // 6: hashmachine.output_length:type_name -> hashmachine.HashFunctionOutputLength
-	7, // [7:7] is the sub-list for method output_type
-	7, // [7:7] is the sub-list for method input_type
-	6, // [6:7] is the sub-list for extension type_name
-	5, // [5:6] is the sub-list for extension extendee
-	0, // [0:5] is the sub-list for field type_name
+	1,  // 0: hashmachine.HashConfig.hash_function:type_name -> hashmachine.HashFunction
+	2,  // 1: hashmachine.HashConfig.node_position:type_name -> hashmachine.NodePosition
+	5,  // 2: hashmachine.ProgramMetadata.hash_config:type_name -> hashmachine.HashConfig
+	5,  // 3: hashmachine.ProgramMetadata.hash_configs:type_name -> hashmachine.HashConfig
+	3,  // 4: hashmachine.Op.opcode:type_name -> hashmachine.OpCode
+	6,  // 5: hashmachine.Program.metadata:type_name -> hashmachine.ProgramMetadata
+	7,  // 6: hashmachine.Program.ops:type_name -> hashmachine.Op
+	9,  // 7: hashmachine.Program.subroutines:type_name -> hashmachine.Subroutine
+	7,  // 8: hashmachine.Subroutine.ops:type_name -> hashmachine.Op
+	8,  // 9: hashmachine.Template.program:type_name -> hashmachine.Program
+	4,  // 10: hashmachine.Template.params:type_name -> hashmachine.ParamType
+	8,  // 11: hashmachine.Proof.program:type_name -> hashmachine.Program
+	12, // 12: hashmachine.output_length:extendee -> google.protobuf.EnumValueOptions
+	0,  // 13: hashmachine.output_length:type_name -> hashmachine.HashFunctionOutputLength
+	14, // [14:14] is the sub-list for method output_type
+	14, // [14:14] is the sub-list for method input_type
+	13, // [13:14] is the sub-list for extension type_name
+	12, // [12:13] is the sub-list for extension extendee
+	0,  // [0:12] is the sub-list for field type_name
 }
 
 func init() { file_hashmachine_proto_init() }
@@ -688,14 +1395,50 @@ func file_hashmachine_proto_init() {
 				return nil
 			}
 		}
+		file_hashmachine_proto_msgTypes[4].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*Subroutine); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_hashmachine_proto_msgTypes[5].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*Template); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_hashmachine_proto_msgTypes[6].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*Proof); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
 	}
 	type x struct{}
 	out := protoimpl.TypeBuilder{
 		File: protoimpl.DescBuilder{
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: file_hashmachine_proto_rawDesc,
-			NumEnums:      3,
-			NumMessages:   4,
+			NumEnums:      5,
+			NumMessages:   7,
 			NumExtensions: 1,
 			NumServices:   0,
 		},
@@ -0,0 +1,130 @@
+// Package bitcoin converts Bitcoin SPV (simplified payment verification)
+// proofs into hashmachine programs.
+//
+// Bitcoin hashes transactions into a binary merkle tree using SHA256d. When a
+// level of the tree has an odd number of nodes, the last node is paired with
+// itself. The root of the tree is committed to in the block header, whose
+// SHA256d hash is the block hash.
+//
+// Hashes are handled in internal byte order, the order in which they are
+// hashed. Bitcoin conventionally displays hashes (e.g. txids and block hashes)
+// in reverse byte order; ParseHash and FormatHash convert between the two.
+//
+// Programs generated by this package take the txids being proven as inputs and
+// output the block hash, so that SPV proofs are verified with hm.Verify like
+// any other program. Callers must separately check that the block hash is in
+// the best chain.
+package bitcoin
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/vsekhar/hashmachine"
+)
+
+const (
+	// HeaderSize is the size of a serialized block header.
+	HeaderSize = 80
+
+	// HashSize is the size of a txid, merkle tree node or block hash.
+	HashSize = 32
+
+	// Offsets of the merkle root within a block header.
+	merkleRootStart = 36
+	merkleRootEnd   = merkleRootStart + HashSize
+)
+
+// ParseHash parses a hash in display (reversed hex) order and returns it in
+// internal byte order.
+func ParseHash(s string) ([]byte, error) {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	if len(b) != HashSize {
+		return nil, fmt.Errorf("hash has %d bytes, expected %d", len(b), HashSize)
+	}
+	return reverse(b), nil
+}
+
+// FormatHash formats a hash in internal byte order for display.
+func FormatHash(b []byte) string {
+	return hex.EncodeToString(reverse(b))
+}
+
+func reverse(b []byte) []byte {
+	r := make([]byte, len(b))
+	for i, c := range b {
+		r[len(b)-1-i] = c
+	}
+	return r
+}
+
+// BlockHash returns the hash of a serialized block header in internal byte
+// order.
+func BlockHash(header []byte) []byte {
+	h := sha256.Sum256(header)
+	h = sha256.Sum256(h[:])
+	return h[:]
+}
+
+func newProgram(inputs int) *hashmachine.Program {
+	return &hashmachine.Program{
+		Metadata: &hashmachine.ProgramMetadata{
+			HashConfig: &hashmachine.HashConfig{
+				HashFunction: hashmachine.HashFunction_HASHFUNCTION_SHA_256D,
+			},
+			ExpectedInputCount: uint32(inputs),
+			BranchingFactor:    2,
+		},
+	}
+}
+
+// headerOps returns the ops that hash the merkle root on top of the stack into
+// header, replacing it with the block hash.
+func headerOps(header []byte) ([]*hashmachine.Op, error) {
+	if len(header) != HeaderSize {
+		return nil, fmt.Errorf("block header has %d bytes, expected %d", len(header), HeaderSize)
+	}
+	return []*hashmachine.Op{
+		{Opcode: hashmachine.OpCode_OPCODE_PREPEND, Payload: header[:merkleRootStart]},
+		{Opcode: hashmachine.OpCode_OPCODE_APPEND, Payload: header[merkleRootEnd:]},
+		{Opcode: hashmachine.OpCode_OPCODE_POP_N_PUSH_HASH, Index: 1},
+	}, nil
+}
+
+// BranchProof returns a program proving that a transaction is included in the
+// block with the given serialized header. Branch is the transaction's merkle
+// branch: the sibling of the transaction and of each of its ancestors below
+// the root, from the bottom up, in internal byte order. Index is the
+// transaction's position in the block.
+//
+// The program takes the txid in internal byte order as its only input and
+// outputs the block hash in internal byte order.
+func BranchProof(header []byte, branch [][]byte, index uint32) (*hashmachine.Program, error) {
+	if index>>len(branch) != 0 {
+		return nil, fmt.Errorf("index %d out of range for branch of length %d", index, len(branch))
+	}
+	p := newProgram(1)
+	p.Ops = append(p.Ops, &hashmachine.Op{Opcode: hashmachine.OpCode_OPCODE_PUSH_INPUT, Index: 0})
+	for i, s := range branch {
+		if len(s) != HashSize {
+			return nil, fmt.Errorf("branch hash %d has %d bytes, expected %d", i, len(s), HashSize)
+		}
+		p.Ops = append(p.Ops, &hashmachine.Op{Opcode: hashmachine.OpCode_OPCODE_PUSH_BYTES, Payload: s})
+		if index>>i&1 == 0 {
+			// The current node is on the left, so it must be popped (and
+			// hashed) first.
+			p.Ops = append(p.Ops, &hashmachine.Op{Opcode: hashmachine.OpCode_OPCODE_SWAP, Index: 1})
+		}
+		p.Ops = append(p.Ops, &hashmachine.Op{Opcode: hashmachine.OpCode_OPCODE_POP_CHILDREN_PUSH_HASH})
+	}
+	ops, err := headerOps(header)
+	if err != nil {
+		return nil, err
+	}
+	p.Ops = append(p.Ops, ops...)
+	return p, nil
+}
@@ -0,0 +1,204 @@
+package bitcoin_test
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"testing"
+
+	"github.com/vsekhar/hashmachine/pkg/bitcoin"
+	"github.com/vsekhar/hashmachine/pkg/hm"
+)
+
+func sha256d(b ...[]byte) []byte {
+	h := sha256.New()
+	for _, v := range b {
+		h.Write(v)
+	}
+	s := sha256.Sum256(h.Sum(nil))
+	return s[:]
+}
+
+// levels returns the levels of the merkle tree of txids, from the leaves up.
+func levels(txids [][]byte) [][][]byte {
+	r := [][][]byte{txids}
+	for level := txids; len(level) > 1; {
+		var next [][]byte
+		for i := 0; i < len(level); i += 2 {
+			right := level[i]
+			if i+1 < len(level) {
+				right = level[i+1]
+			}
+			next = append(next, sha256d(level[i], right))
+		}
+		r = append(r, next)
+		level = next
+	}
+	return r
+}
+
+// block returns n txids and a block header committing to them.
+func block(n int) (txids [][]byte, tree [][][]byte, header []byte) {
+	for i := 0; i < n; i++ {
+		txids = append(txids, sha256d([]byte{byte(i)}))
+	}
+	tree = levels(txids)
+	header = make([]byte, bitcoin.HeaderSize)
+	for i := range header {
+		header[i] = byte(i)
+	}
+	copy(header[36:68], tree[len(tree)-1][0])
+	return txids, tree, header
+}
+
+func TestGenesis(t *testing.T) {
+	header, _ := hex.DecodeString("0100000000000000000000000000000000000000000000000000000000000000000000003ba3edfd7a7b12b27ac72c3e67768f617fc81bc3888a51323a9fb8aa4b1e5e4a29ab5f49ffff001d1dac2b7c")
+	txid, err := bitcoin.ParseHash("4a5e1e4baab89f3a32518a88c31bc87f618f76673e2cc77ab2127b7afdeda33b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	blockHash, err := bitcoin.ParseHash("000000000019d6689c085ae165831e934ff763ae46a2a6c172b3f1b60a8ce26f")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(bitcoin.BlockHash(header), blockHash) {
+		t.Errorf("unexpected block hash %s", bitcoin.FormatHash(bitcoin.BlockHash(header)))
+	}
+
+	p, err := bitcoin.BranchProof(header, nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ok, err := hm.Verify(p, [][]byte{txid}, blockHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ok {
+		t.Error("genesis coinbase did not verify")
+	}
+}
+
+func TestBranchProof(t *testing.T) {
+	for n := 1; n <= 9; n++ {
+		txids, tree, header := block(n)
+		for index := range txids {
+			var branch [][]byte
+			for h, pos := 0, index; h < len(tree)-1; h, pos = h+1, pos/2 {
+				sibling := pos ^ 1
+				if sibling >= len(tree[h]) {
+					sibling = pos
+				}
+				branch = append(branch, tree[h][sibling])
+			}
+			p, err := bitcoin.BranchProof(header, branch, uint32(index))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := hm.Validate(p); err != nil {
+				t.Fatalf("n=%d index=%d: %v", n, index, err)
+			}
+			ok, err := hm.Verify(p, [][]byte{txids[index]}, bitcoin.BlockHash(header))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !ok {
+				t.Errorf("n=%d index=%d: proof did not verify", n, index)
+			}
+			if ok, _ := hm.Verify(p, [][]byte{sha256d([]byte("bogus"))}, bitcoin.BlockHash(header)); ok {
+				t.Errorf("n=%d index=%d: proof verified bogus txid", n, index)
+			}
+		}
+	}
+
+	_, _, header := block(4)
+	if _, err := bitcoin.BranchProof(header, make([][]byte, 2), 4); err == nil {
+		t.Error("expected error for index out of range")
+	}
+	if _, err := bitcoin.BranchProof(header[1:], nil, 0); err == nil {
+		t.Error("expected error for short header")
+	}
+}
+
+// merkleBlock encodes a merkleblock message matching txids[i] for each i in
+// matches, following BIP 37.
+func merkleBlock(header []byte, tree [][][]byte, matches map[int]bool) []byte {
+	var hashes [][]byte
+	var bits []bool
+	var build func(h, pos int)
+	build = func(h, pos int) {
+		match := false
+		for i := pos << h; i < (pos+1)<<h && i < len(tree[0]); i++ {
+			match = match || matches[i]
+		}
+		bits = append(bits, match)
+		if h == 0 || !match {
+			hashes = append(hashes, tree[h][pos])
+			return
+		}
+		build(h-1, pos*2)
+		if pos*2+1 < len(tree[h-1]) {
+			build(h-1, pos*2+1)
+		}
+	}
+	build(len(tree)-1, 0)
+
+	b := append([]byte{}, header...)
+	var total [4]byte
+	binary.LittleEndian.PutUint32(total[:], uint32(len(tree[0])))
+	b = append(b, total[:]...)
+	b = append(b, byte(len(hashes)))
+	for _, h := range hashes {
+		b = append(b, h...)
+	}
+	flags := make([]byte, (len(bits)+7)/8)
+	for i, bit := range bits {
+		if bit {
+			flags[i/8] |= 1 << (i % 8)
+		}
+	}
+	b = append(b, byte(len(flags)))
+	return append(b, flags...)
+}
+
+func TestMerkleBlockProof(t *testing.T) {
+	for n := 1; n <= 9; n++ {
+		txids, tree, header := block(n)
+		for _, matches := range []map[int]bool{
+			{0: true},
+			{n - 1: true},
+			{0: true, n / 2: true, n - 1: true},
+		} {
+			mb := merkleBlock(header, tree, matches)
+			p, got, err := bitcoin.MerkleBlockProof(mb)
+			if err != nil {
+				t.Fatalf("n=%d matches=%v: %v", n, matches, err)
+			}
+			var want [][]byte
+			for i, txid := range txids {
+				if matches[i] {
+					want = append(want, txid)
+				}
+			}
+			if len(got) != len(want) {
+				t.Fatalf("n=%d matches=%v: got %d txids, want %d", n, matches, len(got), len(want))
+			}
+			for i := range want {
+				if !bytes.Equal(got[i], want[i]) {
+					t.Errorf("n=%d matches=%v: txid %d mismatch", n, matches, i)
+				}
+			}
+			ok, err := hm.Verify(p, got, bitcoin.BlockHash(header))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !ok {
+				t.Errorf("n=%d matches=%v: proof did not verify", n, matches)
+			}
+
+			if _, _, err := bitcoin.MerkleBlockProof(mb[:len(mb)-1]); err == nil {
+				t.Errorf("n=%d matches=%v: expected error for truncated merkleblock", n, matches)
+			}
+		}
+	}
+}
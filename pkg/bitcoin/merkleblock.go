@@ -0,0 +1,188 @@
+package bitcoin
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/vsekhar/hashmachine"
+)
+
+// maxTransactions bounds the number of transactions a merkleblock can claim,
+// as in Bitcoin Core (a block's maximum weight divided by the minimum weight
+// of a transaction).
+const maxTransactions = 4000000 / 240
+
+// node is a node of a partial merkle tree.
+type node struct {
+	hash        []byte // for pruned nodes and leaves that are not matched
+	input       int    // input index of a matched leaf, or -1
+	left, right *node  // for interior nodes; right is nil if left is paired with itself
+}
+
+// partialTree decodes a partial merkle tree as defined by BIP 37.
+type partialTree struct {
+	total  uint32
+	hashes [][]byte
+	flags  []byte
+	nbits  int // flag bits consumed
+	inputs [][]byte
+}
+
+func (t *partialTree) width(height int) uint32 {
+	return uint32((uint64(t.total) + 1<<height - 1) >> height)
+}
+
+func (t *partialTree) traverse(height int, pos uint32) (*node, error) {
+	if t.nbits >= len(t.flags)*8 {
+		return nil, errors.New("merkleblock: ran out of flag bits")
+	}
+	flag := t.flags[t.nbits/8]>>(t.nbits%8)&1 == 1
+	t.nbits++
+	if height == 0 || !flag {
+		if len(t.hashes) == 0 {
+			return nil, errors.New("merkleblock: ran out of hashes")
+		}
+		n := &node{hash: t.hashes[0], input: -1}
+		t.hashes = t.hashes[1:]
+		if height == 0 && flag {
+			n.input = len(t.inputs)
+			t.inputs = append(t.inputs, n.hash)
+		}
+		return n, nil
+	}
+	left, err := t.traverse(height-1, pos*2)
+	if err != nil {
+		return nil, err
+	}
+	n := &node{input: -1, left: left}
+	if pos*2+1 < t.width(height-1) {
+		if n.right, err = t.traverse(height-1, pos*2+1); err != nil {
+			return nil, err
+		}
+	}
+	return n, nil
+}
+
+// ops returns the ops that push the hash of n onto the stack.
+func (n *node) ops(ops []*hashmachine.Op) []*hashmachine.Op {
+	switch {
+	case n.input >= 0:
+		return append(ops, &hashmachine.Op{Opcode: hashmachine.OpCode_OPCODE_PUSH_INPUT, Index: uint64(n.input)})
+	case n.left == nil:
+		return append(ops, &hashmachine.Op{Opcode: hashmachine.OpCode_OPCODE_PUSH_BYTES, Payload: n.hash})
+	case n.right == nil:
+		ops = n.left.ops(ops)
+		ops = append(ops, &hashmachine.Op{Opcode: hashmachine.OpCode_OPCODE_DUP, Index: 0})
+	default:
+		// Push the right child first so that the left child is popped (and
+		// hashed) first.
+		ops = n.right.ops(ops)
+		ops = n.left.ops(ops)
+	}
+	return append(ops, &hashmachine.Op{Opcode: hashmachine.OpCode_OPCODE_POP_CHILDREN_PUSH_HASH})
+}
+
+// MerkleBlockProof returns a program proving that the transactions matched by
+// a serialized merkleblock message (BIP 37) are included in its block. It also
+// returns the matched txids in internal byte order, which are the program's
+// inputs, in the order the program expects them.
+//
+// The program outputs the block hash in internal byte order. Verifying it with
+// txids other than those returned fails.
+func MerkleBlockProof(merkleBlock []byte) (p *hashmachine.Program, txids [][]byte, err error) {
+	r := &reader{b: merkleBlock}
+	header := r.next(HeaderSize)
+	t := &partialTree{total: binary.LittleEndian.Uint32(r.next(4))}
+	nhashes := r.compactSize()
+	if r.err == nil && nhashes > maxTransactions {
+		return nil, nil, fmt.Errorf("merkleblock: too many hashes: %d", nhashes)
+	}
+	for i := uint64(0); i < nhashes && r.err == nil; i++ {
+		t.hashes = append(t.hashes, r.next(HashSize))
+	}
+	nflags := r.compactSize()
+	if r.err == nil && nflags > uint64(len(r.b)) {
+		return nil, nil, errors.New("merkleblock: unexpected end of message")
+	}
+	t.flags = r.next(int(nflags))
+	if r.err != nil {
+		return nil, nil, fmt.Errorf("merkleblock: %w", r.err)
+	}
+	if len(r.b) != 0 {
+		return nil, nil, fmt.Errorf("merkleblock: %d trailing bytes", len(r.b))
+	}
+	if t.total == 0 || t.total > maxTransactions {
+		return nil, nil, fmt.Errorf("merkleblock: bad transaction count %d", t.total)
+	}
+	if uint64(len(t.hashes)) > uint64(t.total) {
+		return nil, nil, fmt.Errorf("merkleblock: %d hashes for %d transactions", len(t.hashes), t.total)
+	}
+
+	height := 0
+	for t.width(height) > 1 {
+		height++
+	}
+	root, err := t.traverse(height, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(t.hashes) != 0 {
+		return nil, nil, fmt.Errorf("merkleblock: %d unused hashes", len(t.hashes))
+	}
+	if (t.nbits+7)/8 != len(t.flags) {
+		return nil, nil, fmt.Errorf("merkleblock: unused flag bytes")
+	}
+
+	p = newProgram(len(t.inputs))
+	p.Ops = root.ops(nil)
+	ops, err := headerOps(header)
+	if err != nil {
+		return nil, nil, err
+	}
+	p.Ops = append(p.Ops, ops...)
+	return p, t.inputs, nil
+}
+
+// reader reads Bitcoin's serialization format, recording the first error.
+type reader struct {
+	b   []byte
+	err error
+}
+
+func (r *reader) next(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if len(r.b) < n {
+		r.err = errors.New("unexpected end of message")
+		return nil
+	}
+	v := r.b[:n]
+	r.b = r.b[n:]
+	return v
+}
+
+func (r *reader) compactSize() uint64 {
+	b := r.next(1)
+	if r.err != nil {
+		return 0
+	}
+	switch b[0] {
+	case 0xfd:
+		if v := r.next(2); r.err == nil {
+			return uint64(binary.LittleEndian.Uint16(v))
+		}
+	case 0xfe:
+		if v := r.next(4); r.err == nil {
+			return uint64(binary.LittleEndian.Uint32(v))
+		}
+	case 0xff:
+		if v := r.next(8); r.err == nil {
+			return binary.LittleEndian.Uint64(v)
+		}
+	default:
+		return uint64(b[0])
+	}
+	return 0
+}
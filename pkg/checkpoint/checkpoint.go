@@ -0,0 +1,72 @@
+// Package checkpoint parses and verifies signed log checkpoints in the C2SP
+// tlog-checkpoint format. A checkpoint is a signed note whose text is the
+// log's origin, the size of its tree and the tree's root hash, each on its own
+// line, optionally followed by extension lines. Signatures are verified with
+// golang.org/x/mod/sumdb/note.
+package checkpoint
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"golang.org/x/mod/sumdb/note"
+)
+
+// Checkpoint is a log's commitment to a tree of a given size.
+type Checkpoint struct {
+	// Origin uniquely identifies the log.
+	Origin string
+
+	// Size is the number of entries in the log's tree.
+	Size uint64
+
+	// Hash is the root hash of the log's tree.
+	Hash []byte
+
+	// Extensions are any further lines of the checkpoint, without newlines.
+	Extensions []string
+}
+
+// Parse parses the text of a checkpoint, without signatures.
+func Parse(text []byte) (*Checkpoint, error) {
+	s := string(text)
+	if !strings.HasSuffix(s, "\n") {
+		return nil, errors.New("malformed checkpoint: must end in a newline")
+	}
+	lines := strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+	if len(lines) < 3 {
+		return nil, errors.New("malformed checkpoint: expected origin, size and hash")
+	}
+	c := &Checkpoint{Origin: lines[0], Extensions: lines[3:]}
+	if c.Origin == "" {
+		return nil, errors.New("malformed checkpoint: empty origin")
+	}
+	size, err := strconv.ParseUint(lines[1], 10, 64)
+	if err != nil || strconv.FormatUint(size, 10) != lines[1] {
+		return nil, fmt.Errorf("malformed checkpoint: bad size %q", lines[1])
+	}
+	c.Size = size
+	if c.Hash, err = base64.StdEncoding.DecodeString(lines[2]); err != nil || len(c.Hash) == 0 {
+		return nil, fmt.Errorf("malformed checkpoint: bad root hash %q", lines[2])
+	}
+	for _, ext := range c.Extensions {
+		if ext == "" {
+			return nil, errors.New("malformed checkpoint: empty extension line")
+		}
+	}
+	return c, nil
+}
+
+// Open verifies the signatures on a signed checkpoint and parses it. At least
+// one signature must be by one of verifiers, and every signature by one of
+// verifiers must be valid. Signatures by other keys are ignored.
+func Open(signed []byte, verifiers note.Verifiers) (*Checkpoint, error) {
+	n, err := note.Open(signed, verifiers)
+	if err != nil {
+		return nil, err
+	}
+	return Parse([]byte(n.Text))
+}
@@ -0,0 +1,88 @@
+package checkpoint_test
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"testing"
+
+	"github.com/vsekhar/hashmachine/pkg/checkpoint"
+	"golang.org/x/mod/sumdb/note"
+)
+
+// newKey returns a signer and verifier for a new key with the given name.
+func newKey(t *testing.T, name string) (note.Signer, note.Verifier) {
+	t.Helper()
+	skey, vkey, err := note.GenerateKey(rand.Reader, name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := note.NewSigner(skey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, err := note.NewVerifier(vkey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s, v
+}
+
+func sign(t *testing.T, text string, signers ...note.Signer) string {
+	t.Helper()
+	msg, err := note.Sign(&note.Note{Text: text}, signers...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(msg)
+}
+
+func TestOpen(t *testing.T) {
+	log, logV := newKey(t, "example.com/log")
+	witness, witnessV := newKey(t, "witness")
+	other, _ := newKey(t, "example.com/log")
+	text := "example.com/log\n8\nkZq0tPyMjPHXAlr4iHVgj5YiUn3Z/m0uCYG4gHZuVZQ=\n"
+
+	c, err := checkpoint.Open([]byte(sign(t, text, log, witness)), note.VerifierList(logV))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Origin != "example.com/log" || c.Size != 8 || base64.StdEncoding.EncodeToString(c.Hash) != "kZq0tPyMjPHXAlr4iHVgj5YiUn3Z/m0uCYG4gHZuVZQ=" {
+		t.Errorf("unexpected checkpoint %+v", c)
+	}
+
+	signed := sign(t, text, log)
+	bad := map[string]string{
+		"unknown key":        sign(t, text, other),
+		"tampered":           "example.com/log\n9" + signed[len("example.com/log\n8"):],
+		"no signatures":      text,
+		"bad signature line": text + "\n" + "- example.com/log AAAA\n",
+		"not a checkpoint":   sign(t, "example.com/log\n", log),
+	}
+	for name, msg := range bad {
+		if _, err := checkpoint.Open([]byte(msg), note.VerifierList(logV, witnessV)); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	c, err := checkpoint.Parse([]byte("origin\n0\nAA==\next\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(c.Extensions) != 1 || c.Extensions[0] != "ext" {
+		t.Errorf("unexpected extensions %q", c.Extensions)
+	}
+	for _, text := range []string{
+		"origin\n8\nAA==",
+		"origin\n8\n",
+		"\n8\nAA==\n",
+		"origin\n08\nAA==\n",
+		"origin\n-1\nAA==\n",
+		"origin\n8\nnot base64\n",
+	} {
+		if _, err := checkpoint.Parse([]byte(text)); err == nil {
+			t.Errorf("%q: expected error", text)
+		}
+	}
+}
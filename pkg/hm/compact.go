@@ -0,0 +1,40 @@
+package hm
+
+import (
+	"github.com/vsekhar/hashmachine"
+	"google.golang.org/protobuf/proto"
+)
+
+// Compact returns a copy of p in which payloads pushed more than once by
+// OPCODE_PUSH_BYTES are moved to the program's literal table and pushed with
+// OPCODE_PUSH_LITERAL instead. The compacted program verifies identically to
+// p.
+func Compact(p *hashmachine.Program) *hashmachine.Program {
+	counts := make(map[string]int)
+	for _, op := range p.Ops {
+		if op.Opcode == hashmachine.OpCode_OPCODE_PUSH_BYTES {
+			counts[string(op.Payload)]++
+		}
+	}
+
+	r := proto.Clone(p).(*hashmachine.Program)
+	index := make(map[string]uint64)
+	for i, l := range r.Literals {
+		if _, ok := index[string(l)]; !ok {
+			index[string(l)] = uint64(i)
+		}
+	}
+	for j, op := range r.Ops {
+		if op.Opcode != hashmachine.OpCode_OPCODE_PUSH_BYTES || counts[string(op.Payload)] < 2 {
+			continue
+		}
+		i, ok := index[string(op.Payload)]
+		if !ok {
+			i = uint64(len(r.Literals))
+			index[string(op.Payload)] = i
+			r.Literals = append(r.Literals, op.Payload)
+		}
+		r.Ops[j] = &hashmachine.Op{Opcode: hashmachine.OpCode_OPCODE_PUSH_LITERAL, Index: i, HashConfig: op.HashConfig}
+	}
+	return r
+}
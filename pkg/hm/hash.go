@@ -0,0 +1,135 @@
+package hm
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+
+	"github.com/vsekhar/hashmachine"
+	"github.com/vsekhar/hashmachine/pkg/oncehash"
+	"golang.org/x/crypto/sha3"
+	"google.golang.org/protobuf/proto"
+)
+
+// NewHash returns the hash described by cfg, or an error if cfg is invalid.
+// HMAC configs require a key, supplied with WithHMACKey.
+func NewHash(cfg *hashmachine.HashConfig, opts ...Option) (oncehash.Hash, error) {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if cfg == nil {
+		return nil, errors.New("missing hash config")
+	}
+	if cfg.Hmac && len(o.hmacKey) == 0 {
+		return nil, errors.New("HMAC hash config requires a key, see WithHMACKey")
+	}
+	return newHash(cfg, o.hmacKey)
+}
+
+// newHash returns the hash described by cfg, keyed with key if cfg uses HMAC.
+// newHash does not require a key, so that configs can be checked without one.
+func newHash(cfg *hashmachine.HashConfig, key []byte) (oncehash.Hash, error) {
+	if cfg == nil {
+		return nil, errors.New("missing hash config")
+	}
+	desc := cfg.HashFunction.Descriptor().Values().ByNumber(cfg.HashFunction.Number())
+	if desc == nil {
+		return nil, fmt.Errorf("unknown hash function: %d", cfg.HashFunction)
+	}
+	ext := proto.GetExtension(desc.Options(), hashmachine.E_OutputLength)
+	v, ok := ext.(hashmachine.HashFunctionOutputLength)
+	if !ok {
+		return nil, fmt.Errorf("bad output length option for hash function '%s': %#v", cfg.HashFunction.String(), ext)
+	}
+	switch v {
+	case hashmachine.HashFunctionOutputLength_HASHFUNCTIONOUTPUTLENGTH_UNKNOWN:
+		return nil, fmt.Errorf("no hash function length option specified: %s", v)
+	case hashmachine.HashFunctionOutputLength_HASHFUNCTIONOUTPUTLENGTH_FIXED:
+		if cfg.HashOutputLengthBytes != 0 {
+			return nil, fmt.Errorf("fixed-length hash function '%s' has non-zero HashOutputLengthBytes %d", cfg.HashFunction.String(), cfg.HashOutputLengthBytes)
+		}
+	case hashmachine.HashFunctionOutputLength_HASHFUNCTIONOUTPUTLENGTH_VARIABLE:
+		if cfg.HashOutputLengthBytes == 0 {
+			return nil, fmt.Errorf("variable-length hash function '%s' has zero HashOutputLengthBytes %d", cfg.HashFunction.String(), cfg.HashOutputLengthBytes)
+		}
+	}
+
+	var h oncehash.Hash
+	var fixed func() hash.Hash // for fixed-length hash functions
+	switch cfg.HashFunction {
+	case hashmachine.HashFunction_HASHFUNCTION_SHA_256:
+		fixed = sha256.New
+	case hashmachine.HashFunction_HASHFUNCTION_SHA_256D:
+		fixed = func() hash.Hash { return sha256d{sha256.New()} }
+	case hashmachine.HashFunction_HASHFUNCTION_SHA3_512:
+		h = oncehash.WrapShake(sha3.NewShake256(), int(cfg.HashOutputLengthBytes))
+	default:
+		return nil, fmt.Errorf("unknown hash function: %s", cfg.HashFunction.String())
+	}
+	switch {
+	case cfg.Hmac && fixed == nil:
+		return nil, fmt.Errorf("HMAC requires a fixed-length hash function, got '%s'", cfg.HashFunction.String())
+	case cfg.Hmac:
+		h = oncehash.WrapHash(hmac.New(fixed, key))
+	case fixed != nil:
+		h = oncehash.WrapHash(fixed())
+	}
+	if _, ok := hashmachine.NodePosition_name[int32(cfg.NodePosition)]; !ok {
+		return nil, fmt.Errorf("unknown node position: %d", cfg.NodePosition)
+	}
+	if n := cfg.TruncateOutputBytes; n != 0 {
+		if int64(n) > int64(h.Size()) {
+			return nil, fmt.Errorf("truncated output length %d exceeds output length %d of hash function '%s'", n, h.Size(), cfg.HashFunction.String())
+		}
+		h = oncehash.Truncate(h, int(n))
+	}
+	return h, nil
+}
+
+// newHashes returns the hashes configured by md, indexed by Op.hash_config.
+func newHashes(md *hashmachine.ProgramMetadata, opts ...Option) ([]oncehash.Hash, error) {
+	h, err := NewHash(md.HashConfig, opts...)
+	if err != nil {
+		return nil, err
+	}
+	hs := []oncehash.Hash{h}
+	for i, cfg := range md.HashConfigs {
+		h, err := NewHash(cfg, opts...)
+		if err != nil {
+			return nil, fmt.Errorf("hash config %d: %w", i+1, err)
+		}
+		hs = append(hs, h)
+	}
+	return hs, nil
+}
+
+// sha256d is SHA-256 applied twice.
+type sha256d struct {
+	hash.Hash
+}
+
+func (d sha256d) Sum(b []byte) []byte {
+	s := sha256.Sum256(d.Hash.Sum(nil))
+	return append(b, s[:]...)
+}
+
+// hashConfig returns the hash config selected by op. op.HashConfig must be in
+// bounds.
+func hashConfig(md *hashmachine.ProgramMetadata, op *hashmachine.Op) *hashmachine.HashConfig {
+	if op.HashConfig == 0 {
+		return md.HashConfig
+	}
+	return md.HashConfigs[op.HashConfig-1]
+}
+
+// EncodePosition returns the encoding of a node position hashed by configs
+// that commit to node positions.
+func EncodePosition(pos uint64) []byte {
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], pos)
+	return b[:]
+}
@@ -3,57 +3,88 @@ package hm
 
 import (
 	"bytes"
-	"crypto/sha256"
 	"errors"
 	"fmt"
+	"sort"
+	"strings"
 
 	"github.com/vsekhar/hashmachine"
 	"github.com/vsekhar/hashmachine/pkg/oncehash"
-	"golang.org/x/crypto/sha3"
-	"google.golang.org/protobuf/proto"
 )
 
+// AnchorError is returned when a value on the stack does not match the value
+// embedded in the program by OPCODE_MATCH_BYTES.
+type AnchorError struct {
+	Op   int            // index of the failing op, or of the call that reached it
+	Path []SubroutineOp // of the failing op, if it is in a subroutine
+	Got  []byte
+	Want []byte
+}
+
+func (e *AnchorError) Error() string {
+	var path strings.Builder
+	for _, s := range e.Path {
+		fmt.Fprintf(&path, ", subroutine %d op %d", s.Subroutine, s.Op)
+	}
+	return fmt.Sprintf("anchor mismatch at op %d%s: got %x, want %x", e.Op, path.String(), e.Got, e.Want)
+}
+
+// SubroutineOp identifies an op in a subroutine. A path of SubroutineOps,
+// outermost call first, locates an op executed by nested OPCODE_CALLs.
+type SubroutineOp struct {
+	Subroutine int
+	Op         int
+}
+
 type HashMachine struct {
 	program *hashmachine.Program
-	inputs  [][]byte
+	inputs  []*Input
+	used    []bool // inputs used so far
 
-	ip    int
-	h     oncehash.Hash
-	stack [][]byte
+	ip     int
+	hs     []oncehash.Hash // indexed by Op.hash_config
+	stack  [][]byte
+	types  []valueType // of values on the stack, if the program has a typed stack
+	opts   options
+	ops    int            // ops executed so far, counting subroutine ops
+	path   []SubroutineOp // of the op being executed in subroutines
+	hashes int            // hash sums computed so far
+
+	// Outputs matched by OPCODE_MATCH_OUTPUT, set by VerifyOutputs.
+	outputs  [][]byte
+	matched  []bool
+	mismatch bool
+}
+
+func New(p *hashmachine.Program, inputs [][]byte, opts ...Option) (*HashMachine, error) {
+	return NewWithInputs(p, bytesInputs(inputs), opts...)
 }
 
-func New(p *hashmachine.Program, inputs [][]byte) (*HashMachine, error) {
+// NewWithInputs returns a HashMachine that executes p using inputs, which may
+// be streamed.
+func NewWithInputs(p *hashmachine.Program, inputs []*Input, opts ...Option) (*HashMachine, error) {
+	if p.Metadata == nil {
+		return nil, errors.New("invalid program: no metadata")
+	}
 	if int(p.Metadata.ExpectedInputCount) != len(inputs) {
 		return nil, fmt.Errorf("invalid input count: program expected %d, got %d", p.Metadata.ExpectedInputCount, len(inputs))
 	}
 
-	ext := proto.GetExtension(p.Metadata.HashConfig.HashFunction.Descriptor().Values().ByNumber(p.Metadata.HashConfig.GetHashFunction().Number()).Options(), hashmachine.E_OutputLength)
-	v, ok := ext.(hashmachine.HashFunctionOutputLength)
-	if !ok {
-		panic(fmt.Sprintf("bad option value: %#v", v))
+	ret := &HashMachine{program: p, inputs: inputs, used: make([]bool, len(inputs))}
+	for _, opt := range opts {
+		opt(&ret.opts)
 	}
-	switch v {
-	case hashmachine.HashFunctionOutputLength_HASHFUNCTIONOUTPUTLENGTH_UNKNOWN:
-		return nil, fmt.Errorf("no hash function length option specified: %s", v)
-	case hashmachine.HashFunctionOutputLength_HASHFUNCTIONOUTPUTLENGTH_FIXED:
-		if p.Metadata.HashConfig.HashOutputLengthBytes != 0 {
-			return nil, fmt.Errorf("fixed-length hash function '%s' has non-zero HashOutputLengthBytes %d", p.Metadata.HashConfig.HashFunction.String(), p.Metadata.HashConfig.HashOutputLengthBytes)
-		}
-	case hashmachine.HashFunctionOutputLength_HASHFUNCTIONOUTPUTLENGTH_VARIABLE:
-		if p.Metadata.HashConfig.HashOutputLengthBytes == 0 {
-			return nil, fmt.Errorf("variable-length hash function '%s' has zero HashOutputLengthBytes %d", p.Metadata.HashConfig.HashFunction.String(), p.Metadata.HashConfig.HashOutputLengthBytes)
-		}
+	if err := checkSubroutines(p); err != nil {
+		return nil, err
 	}
-
-	ret := &HashMachine{program: p, inputs: inputs}
-	switch p.Metadata.HashConfig.HashFunction {
-	case hashmachine.HashFunction_HASHFUNCTION_SHA_256:
-		ret.h = oncehash.WrapHash(sha256.New())
-	case hashmachine.HashFunction_HASHFUNCTION_SHA3_512:
-		ret.h = oncehash.WrapShake(sha3.NewShake256(), int(p.Metadata.HashConfig.HashOutputLengthBytes))
-	default:
-		return nil, fmt.Errorf("unknown hash function: %s", p.Metadata.HashConfig.HashFunction.String())
+	if err := checkExpandedLen(p, ret.opts.maxOps()); err != nil {
+		return nil, err
+	}
+	hs, err := newHashes(p.Metadata, opts...)
+	if err != nil {
+		return nil, err
 	}
+	ret.hs = hs
 
 	return ret, nil
 }
@@ -73,7 +104,38 @@ func (hm *HashMachine) peak(i int) []byte {
 	return hm.stack[len(hm.stack)-1-i]
 }
 
+// Returns the input at index, checking it against the program's expected
+// input count and marking it used.
+func (hm *HashMachine) input(index uint64) (*Input, error) {
+	if index >= uint64(hm.program.Metadata.ExpectedInputCount) {
+		return nil, fmt.Errorf("invalid program: input index out of bounds %d, program's expected input count %d", index, hm.program.Metadata.ExpectedInputCount)
+	}
+	if int(index) >= len(hm.inputs) {
+		// Shouldn't happen, we check inputs in New.
+		return nil, fmt.Errorf("invalid invocation: program expected input at index %d, invoked with %d total inputs", index, len(hm.inputs))
+	}
+	if hm.used[index] {
+		return nil, fmt.Errorf("invalid program: input %d already used", index)
+	}
+	hm.used[index] = true
+	return hm.inputs[index], nil
+}
+
+// checkInputsUsed returns an error if the program did not use every input.
+// Programs that ignore an input prove nothing about it.
+func (hm *HashMachine) checkInputsUsed() error {
+	for i, u := range hm.used {
+		if !u {
+			return fmt.Errorf("invalid program: input %d not used", i)
+		}
+	}
+	return nil
+}
+
 func (hm *HashMachine) Output() ([]byte, error) {
+	if hm.program.Metadata.ExpectedOutputCount != 0 {
+		return nil, fmt.Errorf("invalid invocation: program has %d outputs, use VerifyOutputs", hm.program.Metadata.ExpectedOutputCount)
+	}
 	if len(hm.stack) != 1 {
 		return nil, fmt.Errorf("invalid program: expected one output on stack, stack size: %d", len(hm.stack))
 	}
@@ -84,76 +146,297 @@ func (hm *HashMachine) Step() error {
 	if hm.ip >= len(hm.program.Ops) {
 		return fmt.Errorf("ip advanced past end of program")
 	}
-	op := hm.program.Ops[hm.ip]
+	return hm.step(hm.program.Ops[hm.ip])
+}
+
+// step executes op as the op at hm.ip and advances hm.ip.
+func (hm *HashMachine) step(op *hashmachine.Op) error {
 	hm.ip++
+	return hm.exec(op)
+}
+
+// exec executes a single op, expanding subroutine calls inline, enforces
+// resource limits and traces the op.
+func (hm *HashMachine) exec(op *hashmachine.Op) error {
+	if op.Opcode == hashmachine.OpCode_OPCODE_CALL {
+		return hm.call(op.Index)
+	}
+	hm.ops++
+	if max := hm.opts.maxOps(); hm.ops > max {
+		return fmt.Errorf("%w: more than %d ops", ErrLimitExceeded, max)
+	}
+	if err := hm.apply(op); err != nil {
+		return err
+	}
+	if hm.opts.limits.MaxStackDepth > 0 && len(hm.stack) > hm.opts.limits.MaxStackDepth {
+		return fmt.Errorf("%w: stack depth %d exceeds %d", ErrLimitExceeded, len(hm.stack), hm.opts.limits.MaxStackDepth)
+	}
+	if len(hm.stack) > 0 {
+		if err := hm.checkValueSize(len(hm.peak(0))); err != nil {
+			return err
+		}
+	}
+	if hm.opts.trace != nil {
+		hm.opts.trace(op, hm.stack)
+	}
+	return nil
+}
+
+// call executes the ops of subroutine i. Subroutines only call subroutines
+// with lower indexes (checked in New), so calls always terminate.
+func (hm *HashMachine) call(i uint64) error {
+	if i >= uint64(len(hm.program.Subroutines)) {
+		return fmt.Errorf("invalid program: subroutine index out of bounds %d, program has %d subroutines", i, len(hm.program.Subroutines))
+	}
+	hm.path = append(hm.path, SubroutineOp{Subroutine: int(i)})
+	for j, op := range hm.program.Subroutines[i].Ops {
+		hm.path[len(hm.path)-1].Op = j
+		if err := hm.exec(op); err != nil {
+			return fmt.Errorf("subroutine %d: %w", i, err)
+		}
+	}
+	hm.path = hm.path[:len(hm.path)-1]
+	return nil
+}
+
+// checkValueSize returns an error if a value of n bytes exceeds the limits.
+func (hm *HashMachine) checkValueSize(n int) error {
+	if max := hm.opts.maxValueBytes(); n > max {
+		return fmt.Errorf("%w: value of %d bytes exceeds %d", ErrLimitExceeded, n, max)
+	}
+	return nil
+}
+
+// apply applies a single op, other than OPCODE_CALL, to the stack.
+func (hm *HashMachine) apply(op *hashmachine.Op) error {
+	e, err := stackEffect(hm.program.Metadata, op)
+	if err != nil {
+		return err
+	}
+	if len(hm.stack) < e.needs {
+		return fmt.Errorf("invalid program: stack underflow, expected at least %d values, found %d", e.needs, len(hm.stack))
+	}
+	hm.hashes += e.hashes
+	if max := hm.opts.maxHashes(); hm.hashes > max {
+		return fmt.Errorf("%w: more than %d hash sums", ErrLimitExceeded, max)
+	}
+	if hm.strict() {
+		if err := checkStrictOp(op); err != nil {
+			return err
+		}
+	}
+	if hm.program.Metadata.TypedStack {
+		if hm.types, err = typeOp(op, e, hm.types); err != nil {
+			return err
+		}
+	}
+	h := hm.hs[op.HashConfig] // checked by stackEffect
 	switch op.Opcode {
-	case hashmachine.OpCode_OPCODE_UNKNOWN:
-		return errors.New("invalid program: opcode is UNKNOWN")
 	case hashmachine.OpCode_OPCODE_PUSH_INPUT:
-		if op.Index >= uint64(hm.program.Metadata.ExpectedInputCount) {
-			return fmt.Errorf("invalid program: input index out of bounds %d, program's expected input count %d", op.Index, hm.program.Metadata.ExpectedInputCount)
+		in, err := hm.input(op.Index)
+		if err != nil {
+			return err
 		}
-		if int(op.Index) >= len(hm.inputs) {
-			// Shouldn't happen, we check inputs in New.
-			return fmt.Errorf("invalid invocation: program expected input at index %d, invoked with %d total inputs", op.Index, len(hm.inputs))
+		b, err := in.bytes(hm.opts.maxValueBytes())
+		if err != nil {
+			return fmt.Errorf("input %d: %w", op.Index, err)
 		}
-		hm.push(hm.inputs[op.Index])
+		if hm.strict() {
+			if err := checkStrict(op, h.Size(), len(b)); err != nil {
+				return err
+			}
+		}
+		hm.push(b)
 	case hashmachine.OpCode_OPCODE_PUSH_BYTES:
+		if hm.strict() {
+			if err := checkStrict(op, h.Size(), len(op.Payload)); err != nil {
+				return err
+			}
+		}
 		hm.push(op.Payload)
+	case hashmachine.OpCode_OPCODE_PUSH_LITERAL:
+		if op.Index >= uint64(len(hm.program.Literals)) {
+			return fmt.Errorf("invalid program: literal index out of bounds %d, program has %d literals", op.Index, len(hm.program.Literals))
+		}
+		if hm.strict() {
+			if err := checkStrict(op, h.Size(), len(hm.program.Literals[op.Index])); err != nil {
+				return err
+			}
+		}
+		hm.push(hm.program.Literals[op.Index])
+	case hashmachine.OpCode_OPCODE_PUSH_PARAM:
+		return fmt.Errorf("invalid program: uninstantiated template parameter %d", op.Index)
 	case hashmachine.OpCode_OPCODE_POP_CHILDREN_PUSH_HASH:
-		if hm.program.Metadata.BranchingFactor < 1 {
-			return fmt.Errorf("bad branching factor in metadata: %d", hm.program.Metadata.BranchingFactor)
+		h.Reset()
+		hm.writePosition(h, op)
+		for i := 0; i < e.pops; i++ {
+			h.Write(hm.pop())
 		}
-		if len(hm.stack) < int(hm.program.Metadata.BranchingFactor) {
-			return fmt.Errorf("invalid program: stack underflow, expected at least %d values, found %d", int(hm.program.Metadata.BranchingFactor), len(hm.stack))
+		hm.push(h.Sum(nil))
+	case hashmachine.OpCode_OPCODE_POP_CHILDREN_AND_DATA_PUSH_HASH:
+		h.Reset()
+		hm.writePosition(h, op)
+		for i := 0; i < e.pops; i++ {
+			h.Write(hm.pop()) // children, then data
 		}
-		hm.h.Reset()
-		for i := 0; i < int(hm.program.Metadata.BranchingFactor); i++ {
-			hm.h.Write(hm.pop())
+		hm.push(h.Sum(nil))
+	case hashmachine.OpCode_OPCODE_POP_SORTED_CHILDREN_PUSH_HASH:
+		children := make([][]byte, e.pops)
+		for i := range children {
+			children[i] = hm.pop()
 		}
-		hm.push(hm.h.Sum(nil))
-	case hashmachine.OpCode_OPCODE_POP_N_PUSH_HASH:
-		if len(hm.stack) < int(op.Index) {
-			return fmt.Errorf("invalid program: stack underflow, expected at least %d values, found %d", int(op.Index), len(hm.stack))
+		sort.Slice(children, func(i, j int) bool { return bytes.Compare(children[i], children[j]) < 0 })
+		h.Reset()
+		hm.writePosition(h, op)
+		for _, c := range children {
+			h.Write(c)
 		}
-		hm.h.Reset()
+		hm.push(h.Sum(nil))
+	case hashmachine.OpCode_OPCODE_POP_N_PUSH_HASH:
+		h.Reset()
 		for i := 0; i < int(op.Index); i++ {
-			hm.h.Write(hm.pop())
+			h.Write(hm.pop())
 		}
-		hm.push(hm.h.Sum(nil))
+		hm.push(h.Sum(nil))
 	case hashmachine.OpCode_OPCODE_PEAK_N_PUSH_HASH:
-		if len(hm.stack) < int(op.Index) {
-			return fmt.Errorf("invalid program: stack underflow, expected at least %d values, found %d", int(op.Index), len(hm.stack))
-		}
-		hm.h.Reset()
+		h.Reset()
 		for i := 0; i < int(op.Index); i++ {
-			hm.h.Write(hm.peak(i))
+			h.Write(hm.peak(i))
 		}
-		hm.push(hm.h.Sum(nil))
+		hm.push(h.Sum(nil))
 	case hashmachine.OpCode_OPCODE_MATCH_INPUT:
-		if op.Index >= uint64(hm.program.Metadata.ExpectedInputCount) {
-			return fmt.Errorf("invalid program: input index out of bounds %d, program's expected input count %d", op.Index, hm.program.Metadata.ExpectedInputCount)
+		in, err := hm.input(op.Index)
+		if err != nil {
+			return err
 		}
-		if int(op.Index) >= len(hm.inputs) {
-			// Shouldn't happen, we check inputs in New.
-			return fmt.Errorf("invalid invocation: program expected input at index %d, invoked with %d total inputs", op.Index, len(hm.inputs))
+		b, err := in.bytes(hm.opts.maxValueBytes())
+		if err != nil {
+			return fmt.Errorf("input %d: %w", op.Index, err)
 		}
 		v := hm.pop()
-		if !bytes.Equal(v, hm.inputs[op.Index]) {
-			return fmt.Errorf("invalid program: value (%x) does not match input %d (%x)", v, op.Index, hm.inputs[op.Index])
+		if !bytes.Equal(v, b) {
+			return fmt.Errorf("invalid program: value (%x) does not match input %d (%x)", v, op.Index, b)
+		}
+	case hashmachine.OpCode_OPCODE_PUSH_INPUT_HASHED:
+		in, err := hm.input(op.Index)
+		if err != nil {
+			return err
+		}
+		h.Reset()
+		h.Write(op.Payload)
+		if err := in.writeTo(h); err != nil {
+			return fmt.Errorf("input %d: %w", op.Index, err)
+		}
+		hm.push(h.Sum(nil))
+	case hashmachine.OpCode_OPCODE_MATCH_OUTPUT:
+		if op.Index >= uint64(hm.program.Metadata.ExpectedOutputCount) {
+			return fmt.Errorf("invalid program: output index out of bounds %d, program's expected output count %d", op.Index, hm.program.Metadata.ExpectedOutputCount)
 		}
+		if hm.outputs == nil {
+			return fmt.Errorf("invalid invocation: program has %d outputs, use VerifyOutputs", hm.program.Metadata.ExpectedOutputCount)
+		}
+		if hm.matched[op.Index] {
+			return fmt.Errorf("invalid program: output %d matched more than once", op.Index)
+		}
+		hm.matched[op.Index] = true
+		if !bytes.Equal(hm.pop(), hm.outputs[op.Index]) {
+			hm.mismatch = true
+		}
+	case hashmachine.OpCode_OPCODE_MATCH_BYTES:
+		if v := hm.pop(); !bytes.Equal(v, op.Payload) {
+			path := append([]SubroutineOp(nil), hm.path...)
+			return &AnchorError{Op: hm.ip - 1, Path: path, Got: v, Want: op.Payload}
+		}
+	case hashmachine.OpCode_OPCODE_CONCAT:
+		n := 0
+		for i := 0; i < int(op.Index); i++ {
+			n += len(hm.peak(i))
+		}
+		if err := hm.checkValueSize(n); err != nil {
+			return err
+		}
+		v := make([]byte, 0, n)
+		for i := 0; i < int(op.Index); i++ {
+			v = append(v, hm.pop()...)
+		}
+		hm.push(v)
+	case hashmachine.OpCode_OPCODE_PREPEND, hashmachine.OpCode_OPCODE_APPEND:
+		if err := hm.checkValueSize(len(hm.peak(0)) + len(op.Payload)); err != nil {
+			return err
+		}
+		top := hm.pop()
+		v := make([]byte, 0, len(top)+len(op.Payload))
+		if op.Opcode == hashmachine.OpCode_OPCODE_PREPEND {
+			v = append(append(v, op.Payload...), top...)
+		} else {
+			v = append(append(v, top...), op.Payload...)
+		}
+		hm.push(v)
+	case hashmachine.OpCode_OPCODE_SLICE:
+		top := hm.pop()
+		if op.Index > uint64(len(top)) || op.Length > uint64(len(top))-op.Index {
+			return fmt.Errorf("invalid program: slice [%d:+%d] out of range for value of length %d", op.Index, op.Length, len(top))
+		}
+		hm.push(top[op.Index : op.Index+op.Length])
+	case hashmachine.OpCode_OPCODE_REPEAT_HASH:
+		h.Reset()
+		h.Write(hm.pop())
+		h.Write(op.Payload)
+		v := h.Sum(nil)
+		for i := 1; i < int(op.Index); i++ {
+			h.Reset()
+			h.Write(v)
+			v = h.Sum(v[:0]) // v is no longer needed once written
+		}
+		hm.push(v)
+	case hashmachine.OpCode_OPCODE_DUP:
+		hm.push(hm.peak(int(op.Index)))
+	case hashmachine.OpCode_OPCODE_SWAP:
+		top, i := len(hm.stack)-1, len(hm.stack)-1-int(op.Index)
+		hm.stack[top], hm.stack[i] = hm.stack[i], hm.stack[top]
+	case hashmachine.OpCode_OPCODE_ROT:
+		n := len(hm.stack)
+		hm.stack[n-3], hm.stack[n-2], hm.stack[n-1] = hm.stack[n-2], hm.stack[n-1], hm.stack[n-3]
+	case hashmachine.OpCode_OPCODE_DROP:
+		hm.pop()
 	default:
+		if spec, ok := lookupOp(op.Opcode); ok {
+			return hm.applyVendor(op, spec, e, h)
+		}
 		return fmt.Errorf("invalid program: unknown opcode %d", op.Opcode)
 	}
 	return nil
 }
 
+// strict reports whether the program executes in strict mode.
+func (hm *HashMachine) strict() bool {
+	return hm.program.Metadata.Strict || hm.opts.strict
+}
+
+// writePosition writes the node position in op to h if the op's hash config
+// commits to node positions.
+func (hm *HashMachine) writePosition(h oncehash.Hash, op *hashmachine.Op) {
+	if hashConfig(hm.program.Metadata, op).NodePosition != hashmachine.NodePosition_NODEPOSITION_NONE {
+		h.Write(EncodePosition(op.Index))
+	}
+}
+
 func (hm *HashMachine) Done() bool {
 	return hm.ip >= len(hm.program.Ops)
 }
 
-func VerifyWithOutput(prog *hashmachine.Program, inputs [][]byte, expected []byte) (ok bool, output []byte, err error) {
-	hm, err := New(prog, inputs)
+func VerifyWithOutput(prog *hashmachine.Program, inputs [][]byte, expected []byte, opts ...Option) (ok bool, output []byte, err error) {
+	return verifyInputs(prog, bytesInputs(inputs), expected, opts...)
+}
+
+// VerifyInputs is like Verify but accepts inputs which may be streamed.
+func VerifyInputs(prog *hashmachine.Program, inputs []*Input, expected []byte, opts ...Option) (ok bool, err error) {
+	ok, _, err = verifyInputs(prog, inputs, expected, opts...)
+	return ok, err
+}
+
+func verifyInputs(prog *hashmachine.Program, inputs []*Input, expected []byte, opts ...Option) (ok bool, output []byte, err error) {
+	hm, err := NewWithInputs(prog, inputs, opts...)
 	if err != nil {
 		return false, nil, err
 	}
@@ -162,6 +445,9 @@ func VerifyWithOutput(prog *hashmachine.Program, inputs [][]byte, expected []byt
 			return false, nil, err
 		}
 	}
+	if err := hm.checkInputsUsed(); err != nil {
+		return false, nil, err
+	}
 	out, err := hm.Output()
 	if err != nil {
 		return false, out, err
@@ -169,7 +455,53 @@ func VerifyWithOutput(prog *hashmachine.Program, inputs [][]byte, expected []byt
 	return bytes.Equal(out, expected), out, nil
 }
 
-func Verify(prog *hashmachine.Program, inputs [][]byte, expected []byte) (ok bool, err error) {
-	ok, _, err = VerifyWithOutput(prog, inputs, expected)
+func Verify(prog *hashmachine.Program, inputs [][]byte, expected []byte, opts ...Option) (ok bool, err error) {
+	ok, _, err = VerifyWithOutput(prog, inputs, expected, opts...)
 	return ok, err
 }
+
+// VerifyOutputs executes prog with inputs and compares the program's outputs
+// with outputs.
+//
+// If the program's expected_output_count is zero, outputs must have length
+// one and VerifyOutputs is equivalent to Verify. Otherwise outputs must have
+// length expected_output_count, each must be matched exactly once by
+// OPCODE_MATCH_OUTPUT and no values may be left on the stack.
+func VerifyOutputs(prog *hashmachine.Program, inputs [][]byte, outputs [][]byte, opts ...Option) (ok bool, err error) {
+	if prog.Metadata == nil {
+		return false, errors.New("invalid program: no metadata")
+	}
+	n := int(prog.Metadata.ExpectedOutputCount)
+	if n == 0 {
+		if len(outputs) != 1 {
+			return false, fmt.Errorf("invalid output count: program has one output, got %d", len(outputs))
+		}
+		return Verify(prog, inputs, outputs[0], opts...)
+	}
+	if len(outputs) != n {
+		return false, fmt.Errorf("invalid output count: program expected %d, got %d", n, len(outputs))
+	}
+	hm, err := New(prog, inputs, opts...)
+	if err != nil {
+		return false, err
+	}
+	hm.outputs = outputs
+	hm.matched = make([]bool, n)
+	for !hm.Done() {
+		if err := hm.Step(); err != nil {
+			return false, err
+		}
+	}
+	if err := hm.checkInputsUsed(); err != nil {
+		return false, err
+	}
+	if len(hm.stack) != 0 {
+		return false, fmt.Errorf("invalid program: expected empty stack, stack size: %d", len(hm.stack))
+	}
+	for i, m := range hm.matched {
+		if !m {
+			return false, fmt.Errorf("invalid program: output %d not matched", i)
+		}
+	}
+	return !hm.mismatch, nil
+}
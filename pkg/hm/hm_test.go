@@ -1,11 +1,22 @@
 package hm_test
 
 import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
 	"encoding/base64"
+	"errors"
+	"io"
+	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/vsekhar/hashmachine"
 	"github.com/vsekhar/hashmachine/pkg/hm"
+	"github.com/vsekhar/hashmachine/pkg/oncehash"
+	"golang.org/x/crypto/sha3"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
 )
 
 func DecodeBase64OrDie(s string) []byte {
@@ -65,6 +76,135 @@ var hashInput3 *hashmachine.Program = &hashmachine.Program{
 	},
 }
 
+var hashedInput *hashmachine.Program = &hashmachine.Program{
+	Metadata: &hashmachine.ProgramMetadata{
+		HashConfig: &hashmachine.HashConfig{
+			HashFunction: hashmachine.HashFunction_HASHFUNCTION_SHA_256,
+		},
+		ExpectedInputCount: 1,
+		BranchingFactor:    0,
+	},
+	Ops: []*hashmachine.Op{
+		{Opcode: hashmachine.OpCode_OPCODE_PUSH_INPUT_HASHED, Index: 0},
+	},
+}
+
+var prefixedInput *hashmachine.Program = &hashmachine.Program{
+	Metadata: &hashmachine.ProgramMetadata{
+		HashConfig: &hashmachine.HashConfig{
+			HashFunction: hashmachine.HashFunction_HASHFUNCTION_SHA_256,
+		},
+		ExpectedInputCount: 1,
+		BranchingFactor:    0,
+	},
+	Ops: []*hashmachine.Op{
+		{Opcode: hashmachine.OpCode_OPCODE_PUSH_INPUT_HASHED, Index: 0, Payload: []byte{0}},
+	},
+}
+
+// gitBlob hashes its input as a git blob object of length 5 (using SHA-256).
+var gitBlob *hashmachine.Program = &hashmachine.Program{
+	Metadata: &hashmachine.ProgramMetadata{
+		HashConfig: &hashmachine.HashConfig{
+			HashFunction: hashmachine.HashFunction_HASHFUNCTION_SHA_256,
+		},
+		ExpectedInputCount: 1,
+	},
+	Ops: []*hashmachine.Op{
+		{Opcode: hashmachine.OpCode_OPCODE_PUSH_INPUT, Index: 0},
+		{Opcode: hashmachine.OpCode_OPCODE_PREPEND, Payload: []byte("blob 5\x00")},
+		{Opcode: hashmachine.OpCode_OPCODE_POP_N_PUSH_HASH, Index: 1},
+	},
+}
+
+// concat hashes the concatenation of two inputs, equivalent to hashInput2.
+var concat *hashmachine.Program = &hashmachine.Program{
+	Metadata: &hashmachine.ProgramMetadata{
+		HashConfig: &hashmachine.HashConfig{
+			HashFunction: hashmachine.HashFunction_HASHFUNCTION_SHA_256,
+		},
+		ExpectedInputCount: 2,
+	},
+	Ops: []*hashmachine.Op{
+		{Opcode: hashmachine.OpCode_OPCODE_PUSH_INPUT, Index: 0},
+		{Opcode: hashmachine.OpCode_OPCODE_PUSH_INPUT, Index: 1},
+		{Opcode: hashmachine.OpCode_OPCODE_CONCAT, Index: 2},
+		{Opcode: hashmachine.OpCode_OPCODE_POP_N_PUSH_HASH, Index: 1},
+	},
+}
+
+// slice hashes a single byte sliced out of a wrapped input.
+var slice *hashmachine.Program = &hashmachine.Program{
+	Metadata: &hashmachine.ProgramMetadata{
+		HashConfig: &hashmachine.HashConfig{
+			HashFunction: hashmachine.HashFunction_HASHFUNCTION_SHA_256,
+		},
+		ExpectedInputCount: 1,
+	},
+	Ops: []*hashmachine.Op{
+		{Opcode: hashmachine.OpCode_OPCODE_PUSH_INPUT, Index: 0},
+		{Opcode: hashmachine.OpCode_OPCODE_PREPEND, Payload: []byte("xx")},
+		{Opcode: hashmachine.OpCode_OPCODE_APPEND, Payload: []byte("yy")},
+		{Opcode: hashmachine.OpCode_OPCODE_SLICE, Index: 2, Length: 1},
+		{Opcode: hashmachine.OpCode_OPCODE_POP_N_PUSH_HASH, Index: 1},
+	},
+}
+
+// dup hashes its input twice.
+var dup *hashmachine.Program = &hashmachine.Program{
+	Metadata: &hashmachine.ProgramMetadata{
+		HashConfig: &hashmachine.HashConfig{
+			HashFunction: hashmachine.HashFunction_HASHFUNCTION_SHA_256,
+		},
+		ExpectedInputCount: 1,
+	},
+	Ops: []*hashmachine.Op{
+		{Opcode: hashmachine.OpCode_OPCODE_PUSH_INPUT, Index: 0},
+		{Opcode: hashmachine.OpCode_OPCODE_PUSH_BYTES, Payload: []byte("junk")},
+		{Opcode: hashmachine.OpCode_OPCODE_DROP},
+		{Opcode: hashmachine.OpCode_OPCODE_DUP, Index: 0},
+		{Opcode: hashmachine.OpCode_OPCODE_POP_N_PUSH_HASH, Index: 2},
+	},
+}
+
+// sortedPair hashes its input and a sibling in sorted order, regardless of
+// the order in which they are pushed.
+func sortedPair(sibling []byte, siblingFirst bool) *hashmachine.Program {
+	ops := []*hashmachine.Op{
+		{Opcode: hashmachine.OpCode_OPCODE_PUSH_INPUT, Index: 0},
+		{Opcode: hashmachine.OpCode_OPCODE_PUSH_BYTES, Payload: sibling},
+	}
+	if siblingFirst {
+		ops[0], ops[1] = ops[1], ops[0]
+	}
+	ops = append(ops, &hashmachine.Op{Opcode: hashmachine.OpCode_OPCODE_POP_SORTED_CHILDREN_PUSH_HASH})
+	return &hashmachine.Program{
+		Metadata: &hashmachine.ProgramMetadata{
+			HashConfig: &hashmachine.HashConfig{
+				HashFunction: hashmachine.HashFunction_HASHFUNCTION_SHA_256,
+			},
+			ExpectedInputCount: 1,
+			BranchingFactor:    2,
+		},
+		Ops: ops,
+	}
+}
+
+// chain hashes its input with a payload and then rehashes the result for a
+// total of 1000 hashes.
+var chain *hashmachine.Program = &hashmachine.Program{
+	Metadata: &hashmachine.ProgramMetadata{
+		HashConfig: &hashmachine.HashConfig{
+			HashFunction: hashmachine.HashFunction_HASHFUNCTION_SHA_256,
+		},
+		ExpectedInputCount: 1,
+	},
+	Ops: []*hashmachine.Op{
+		{Opcode: hashmachine.OpCode_OPCODE_PUSH_INPUT, Index: 0},
+		{Opcode: hashmachine.OpCode_OPCODE_REPEAT_HASH, Index: 1000, Payload: []byte("p")},
+	},
+}
+
 // The tests below use the following MMR, where leafs are just the
 // corresponding letter and non-leafs are the hashes of their children.
 //
@@ -151,6 +291,27 @@ var bInO *hashmachine.Program = &hashmachine.Program{
 	},
 }
 
+// bInOSwap is bInO with the input pushed before its sibling.
+var bInOSwap *hashmachine.Program = &hashmachine.Program{
+	Metadata: &hashmachine.ProgramMetadata{
+		HashConfig: &hashmachine.HashConfig{
+			HashFunction: hashmachine.HashFunction_HASHFUNCTION_SHA_256,
+		},
+		ExpectedInputCount: 1,
+		BranchingFactor:    2,
+	},
+	Ops: []*hashmachine.Op{
+		{Opcode: hashmachine.OpCode_OPCODE_PUSH_INPUT, Index: 0}, // b
+		{Opcode: hashmachine.OpCode_OPCODE_PUSH_BYTES, Payload: a},
+		{Opcode: hashmachine.OpCode_OPCODE_SWAP, Index: 1},
+		{Opcode: hashmachine.OpCode_OPCODE_POP_CHILDREN_PUSH_HASH}, // c
+		{Opcode: hashmachine.OpCode_OPCODE_PUSH_BYTES, Payload: f},
+		{Opcode: hashmachine.OpCode_OPCODE_POP_CHILDREN_PUSH_HASH}, // g
+		{Opcode: hashmachine.OpCode_OPCODE_PUSH_BYTES, Payload: n},
+		{Opcode: hashmachine.OpCode_OPCODE_POP_CHILDREN_PUSH_HASH}, // o
+	},
+}
+
 var jInO *hashmachine.Program = &hashmachine.Program{
 	Metadata: &hashmachine.ProgramMetadata{
 		HashConfig: &hashmachine.HashConfig{
@@ -168,6 +329,25 @@ var jInO *hashmachine.Program = &hashmachine.Program{
 	},
 }
 
+// jInORot is jInO with its literals pushed first.
+var jInORot *hashmachine.Program = &hashmachine.Program{
+	Metadata: &hashmachine.ProgramMetadata{
+		HashConfig: &hashmachine.HashConfig{
+			HashFunction: hashmachine.HashFunction_HASHFUNCTION_SHA_256,
+		},
+		ExpectedInputCount: 1,
+		BranchingFactor:    2,
+	},
+	Ops: []*hashmachine.Op{
+		{Opcode: hashmachine.OpCode_OPCODE_PUSH_BYTES, Payload: m},
+		{Opcode: hashmachine.OpCode_OPCODE_PUSH_BYTES, Payload: g},
+		{Opcode: hashmachine.OpCode_OPCODE_PUSH_INPUT, Index: 0},   // j
+		{Opcode: hashmachine.OpCode_OPCODE_ROT},                    // g, j, m
+		{Opcode: hashmachine.OpCode_OPCODE_POP_CHILDREN_PUSH_HASH}, // n
+		{Opcode: hashmachine.OpCode_OPCODE_POP_CHILDREN_PUSH_HASH}, // o
+	},
+}
+
 var bAndJInO *hashmachine.Program = &hashmachine.Program{
 	Metadata: &hashmachine.ProgramMetadata{
 		HashConfig: &hashmachine.HashConfig{
@@ -244,6 +424,86 @@ var consistency *hashmachine.Program = &hashmachine.Program{
 	},
 }
 
+// checkpoints proves consistency of mmr1 and mmr2 as outputs of one program.
+var checkpoints *hashmachine.Program = &hashmachine.Program{
+	Metadata: &hashmachine.ProgramMetadata{
+		HashConfig: &hashmachine.HashConfig{
+			HashFunction: hashmachine.HashFunction_HASHFUNCTION_SHA_256,
+		},
+		ExpectedInputCount:  0,
+		ExpectedOutputCount: 2,
+		BranchingFactor:     2,
+	},
+	Ops: []*hashmachine.Op{
+		{Opcode: hashmachine.OpCode_OPCODE_PUSH_BYTES, Payload: o},
+		{Opcode: hashmachine.OpCode_OPCODE_PUSH_BYTES, Payload: r},
+		{Opcode: hashmachine.OpCode_OPCODE_PUSH_BYTES, Payload: s},
+		{Opcode: hashmachine.OpCode_OPCODE_PEAK_N_PUSH_HASH, Index: 3}, // mmr1
+		{Opcode: hashmachine.OpCode_OPCODE_MATCH_OUTPUT, Index: 0},
+		{Opcode: hashmachine.OpCode_OPCODE_PUSH_BYTES, Payload: T},
+		{Opcode: hashmachine.OpCode_OPCODE_POP_CHILDREN_PUSH_HASH},    // U
+		{Opcode: hashmachine.OpCode_OPCODE_POP_CHILDREN_PUSH_HASH},    // V
+		{Opcode: hashmachine.OpCode_OPCODE_POP_N_PUSH_HASH, Index: 2}, // mmr2
+		{Opcode: hashmachine.OpCode_OPCODE_MATCH_OUTPUT, Index: 1},
+	},
+}
+
+// anchored proves mmr2 from a published mmr1 checkpoint embedded in the
+// program.
+func anchored(checkpoint []byte) *hashmachine.Program {
+	return &hashmachine.Program{
+		Metadata: &hashmachine.ProgramMetadata{
+			HashConfig: &hashmachine.HashConfig{
+				HashFunction: hashmachine.HashFunction_HASHFUNCTION_SHA_256,
+			},
+			ExpectedInputCount: 0,
+			BranchingFactor:    2,
+		},
+		Ops: []*hashmachine.Op{
+			{Opcode: hashmachine.OpCode_OPCODE_PUSH_BYTES, Payload: o},
+			{Opcode: hashmachine.OpCode_OPCODE_PUSH_BYTES, Payload: r},
+			{Opcode: hashmachine.OpCode_OPCODE_PUSH_BYTES, Payload: s},
+			{Opcode: hashmachine.OpCode_OPCODE_PEAK_N_PUSH_HASH, Index: 3}, // mmr1
+			{Opcode: hashmachine.OpCode_OPCODE_MATCH_BYTES, Payload: checkpoint},
+			{Opcode: hashmachine.OpCode_OPCODE_PUSH_BYTES, Payload: T},
+			{Opcode: hashmachine.OpCode_OPCODE_POP_CHILDREN_PUSH_HASH},    // U
+			{Opcode: hashmachine.OpCode_OPCODE_POP_CHILDREN_PUSH_HASH},    // V
+			{Opcode: hashmachine.OpCode_OPCODE_POP_N_PUSH_HASH, Index: 2}, // mmr2
+		},
+	}
+}
+
+// consistencySub is consistency with its repeated ops factored out into
+// subroutines.
+var consistencySub *hashmachine.Program = &hashmachine.Program{
+	Metadata: consistency.Metadata,
+	Ops: []*hashmachine.Op{
+		{Opcode: hashmachine.OpCode_OPCODE_PUSH_BYTES, Payload: o},
+		{Opcode: hashmachine.OpCode_OPCODE_PUSH_BYTES, Payload: r},
+		{Opcode: hashmachine.OpCode_OPCODE_PUSH_BYTES, Payload: s},
+		{Opcode: hashmachine.OpCode_OPCODE_PEAK_N_PUSH_HASH, Index: 3}, // mmr1
+		{Opcode: hashmachine.OpCode_OPCODE_MATCH_INPUT, Index: 0},
+		{Opcode: hashmachine.OpCode_OPCODE_CALL, Index: 1},
+	},
+	Subroutines: []*hashmachine.Subroutine{
+		{
+			Name: "two parents",
+			Ops: []*hashmachine.Op{
+				{Opcode: hashmachine.OpCode_OPCODE_POP_CHILDREN_PUSH_HASH},
+				{Opcode: hashmachine.OpCode_OPCODE_POP_CHILDREN_PUSH_HASH},
+			},
+		},
+		{
+			Name: "append T",
+			Ops: []*hashmachine.Op{
+				{Opcode: hashmachine.OpCode_OPCODE_PUSH_BYTES, Payload: T},
+				{Opcode: hashmachine.OpCode_OPCODE_CALL, Index: 0},            // U, V
+				{Opcode: hashmachine.OpCode_OPCODE_POP_N_PUSH_HASH, Index: 2}, // mmr2
+			},
+		},
+	},
+}
+
 // TODO: consistency proof of mmr1 to mmr2
 
 type testCase struct {
@@ -255,9 +515,19 @@ type testCase struct {
 var testCases []testCase = []testCase{
 	{hashInput, [][]byte{b}, DecodeBase64OrDie("PiPoFgA5WUoziU9lZOGxNIu9egCI1CxKy3PurtWcAJ0")},
 	{hashN, [][]byte{}, DecodeBase64OrDie("KCv+8LPxgJomsdbjPurWgEjfk1D76sQqR0c4z53/K/g")},
+	{hashedInput, [][]byte{b}, DecodeBase64OrDie("PiPoFgA5WUoziU9lZOGxNIu9egCI1CxKy3PurtWcAJ0")},
+	{prefixedInput, [][]byte{b}, DecodeBase64OrDie("V+s1YV1H807HFMrN9f10YIpejhAnJOgLJLKHwMJ7ajE")},
+
+	{gitBlob, [][]byte{[]byte("hello")}, DecodeBase64OrDie("iuxOSHb4VPaI0Ov8jzdZjzjl/WkDzMyFDKNlkRda62A")},
+	{slice, [][]byte{b}, DecodeBase64OrDie("PiPoFgA5WUoziU9lZOGxNIu9egCI1CxKy3PurtWcAJ0")},
+	{sortedPair(a, true), [][]byte{b}, DecodeBase64OrDie("+44g/C5MPySMYMOb1lLzwTRymLuXe4tNWQO4UFViBgM")},
+	{sortedPair(a, false), [][]byte{b}, DecodeBase64OrDie("+44g/C5MPySMYMOb1lLzwTRymLuXe4tNWQO4UFViBgM")},
+	{chain, [][]byte{b}, DecodeBase64OrDie("62dZ6b12hgAyJ3bNgXJspoHFwfTmZjL2xOY42VKqisM")},
+	{dup, [][]byte{b}, DecodeBase64OrDie("O2TblctVx2M5HHBxCEia4YtBEteDMA3jjgM7TJjD3q8")},
 
 	// Second level
 	{hashInput2, [][]byte{a, b}, c},
+	{concat, [][]byte{a, b}, c},
 	{hashInput2, [][]byte{d, e}, f},
 	{hashInput2, [][]byte{h, i}, j},
 	{hashInput2, [][]byte{k, l}, m},
@@ -276,6 +546,8 @@ var testCases []testCase = []testCase{
 	{bInO, [][]byte{b}, o},
 	{jInO, [][]byte{j}, o},
 	{bAndJInO, [][]byte{b, j}, o},
+	{bInOSwap, [][]byte{b}, o},
+	{jInORot, [][]byte{j}, o},
 
 	// Digests
 	{hashInput2, [][]byte{o, V}, mmr2},
@@ -285,6 +557,8 @@ var testCases []testCase = []testCase{
 
 	// Consistency
 	{consistency, [][]byte{mmr1}, mmr2},
+	{anchored(mmr1), [][]byte{}, mmr2},
+	{consistencySub, [][]byte{mmr1}, mmr2},
 }
 
 func TestProofs(t *testing.T) {
@@ -297,3 +571,1135 @@ func TestProofs(t *testing.T) {
 		}
 	}
 }
+
+func TestStreamingInputs(t *testing.T) {
+	ok, err := hm.VerifyInputs(bInO, []*hm.Input{hm.ReaderInput(bytes.NewReader(b))}, o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ok {
+		t.Error("streamed input: unequal output")
+	}
+
+	leaf := DecodeBase64OrDie("V+s1YV1H807HFMrN9f10YIpejhAnJOgLJLKHwMJ7ajE")
+	ok, err = hm.VerifyInputs(prefixedInput, []*hm.Input{hm.ReaderAtInput(bytes.NewReader(b), int64(len(b)))}, leaf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ok {
+		t.Error("streamed hashed input: unequal output")
+	}
+}
+
+func TestInputReuse(t *testing.T) {
+	reuse := &hashmachine.Program{
+		Metadata: &hashmachine.ProgramMetadata{
+			HashConfig: &hashmachine.HashConfig{
+				HashFunction: hashmachine.HashFunction_HASHFUNCTION_SHA_256,
+			},
+			ExpectedInputCount: 1,
+		},
+		Ops: []*hashmachine.Op{
+			{Opcode: hashmachine.OpCode_OPCODE_PUSH_INPUT, Index: 0},
+			{Opcode: hashmachine.OpCode_OPCODE_PUSH_INPUT, Index: 0},
+			{Opcode: hashmachine.OpCode_OPCODE_POP_N_PUSH_HASH, Index: 2},
+		},
+	}
+	if _, err := hm.Verify(reuse, [][]byte{b}, nil); err == nil {
+		t.Error("expected error for input used twice")
+	}
+	if _, err := hm.VerifyInputs(reuse, []*hm.Input{hm.ReaderInput(bytes.NewReader(b))}, nil); err == nil {
+		t.Error("expected error for streamed input used twice")
+	}
+
+	// Byte string inputs can be reused across verifications.
+	inputs := []*hm.Input{hm.BytesInput(b)}
+	for i := 0; i < 2; i++ {
+		ok, err := hm.VerifyInputs(bInO, inputs, o)
+		if err != nil {
+			t.Fatalf("verification %d: %v", i, err)
+		}
+		if !ok {
+			t.Errorf("verification %d: unequal output", i)
+		}
+	}
+}
+
+func TestUnusedInput(t *testing.T) {
+	md := &hashmachine.ProgramMetadata{
+		HashConfig: &hashmachine.HashConfig{
+			HashFunction: hashmachine.HashFunction_HASHFUNCTION_SHA_256,
+		},
+		ExpectedInputCount: 1,
+	}
+	unused := &hashmachine.Program{
+		Metadata: md,
+		Ops: []*hashmachine.Op{
+			{Opcode: hashmachine.OpCode_OPCODE_PUSH_BYTES, Payload: o},
+		},
+	}
+	var stream bytes.Buffer
+	if err := hm.WriteStream(&stream, unused); err != nil {
+		t.Fatal(err)
+	}
+	multi := &hashmachine.Program{
+		Metadata: &hashmachine.ProgramMetadata{
+			HashConfig:          md.HashConfig,
+			ExpectedInputCount:  1,
+			ExpectedOutputCount: 1,
+		},
+		Ops: []*hashmachine.Op{
+			{Opcode: hashmachine.OpCode_OPCODE_PUSH_BYTES, Payload: o},
+			{Opcode: hashmachine.OpCode_OPCODE_MATCH_OUTPUT, Index: 0},
+		},
+	}
+	verifiers := map[string]func() (bool, error){
+		"Verify": func() (bool, error) { return hm.Verify(unused, [][]byte{b}, o) },
+		"VerifyInputs": func() (bool, error) {
+			return hm.VerifyInputs(unused, []*hm.Input{hm.BytesInput(b)}, o)
+		},
+		"VerifyOutputs": func() (bool, error) { return hm.VerifyOutputs(multi, [][]byte{b}, [][]byte{o}) },
+		"VerifyStream": func() (bool, error) {
+			return hm.VerifyStream(&stream, []*hm.Input{hm.BytesInput(b)}, o)
+		},
+		"VerifyMulti": func() (bool, error) {
+			return hm.VerifyMulti(unused, []*hashmachine.HashConfig{md.HashConfig}, [][]byte{b}, [][]byte{o})
+		},
+	}
+	for name, verify := range verifiers {
+		if ok, err := verify(); err == nil || ok {
+			t.Errorf("%s: expected error for unused input, got %t, %v", name, ok, err)
+		}
+	}
+}
+
+func TestStreamingInputLimit(t *testing.T) {
+	opt := hm.WithLimits(hm.Limits{MaxValueBytes: 64})
+	in := []*hm.Input{hm.ReaderInput(bytes.NewReader(make([]byte, 65)))}
+	if _, err := hm.VerifyInputs(bInO, in, o, opt); !errors.Is(err, hm.ErrLimitExceeded) {
+		t.Errorf("expected ErrLimitExceeded, got %v", err)
+	}
+}
+
+func bytesInputs(inputs [][]byte) []*hm.Input {
+	r := make([]*hm.Input, len(inputs))
+	for i, in := range inputs {
+		r[i] = hm.BytesInput(in)
+	}
+	return r
+}
+
+func TestStream(t *testing.T) {
+	for i, tc := range testCases {
+		var buf bytes.Buffer
+		if err := hm.WriteStream(&buf, tc.p); err != nil {
+			t.Fatalf("test case %d: %v", i, err)
+		}
+		ok, err := hm.VerifyStream(&buf, bytesInputs(tc.inputs), tc.output)
+		if err != nil {
+			t.Errorf("test case %d: %v", i, err)
+		} else if !ok {
+			t.Errorf("test case %d: unequal output", i)
+		}
+	}
+}
+
+func TestLimits(t *testing.T) {
+	cases := []struct {
+		limits     hm.Limits
+		streamOnly bool
+	}{
+		{hm.Limits{MaxOps: 6}, false},
+		{hm.Limits{MaxStackDepth: 2}, false},
+		{hm.Limits{MaxValueBytes: 16}, false},
+		{hm.Limits{MaxMessageBytes: 16}, true},
+	}
+	for i, tc := range cases {
+		opt := hm.WithLimits(tc.limits)
+		if !tc.streamOnly {
+			if _, err := hm.Verify(bAndJInO, [][]byte{b, j}, o, opt); !errors.Is(err, hm.ErrLimitExceeded) {
+				t.Errorf("limit %d: expected ErrLimitExceeded, got %v", i, err)
+			}
+		}
+		var buf bytes.Buffer
+		if err := hm.WriteStream(&buf, bAndJInO); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := hm.VerifyStream(&buf, bytesInputs([][]byte{b, j}), o, opt); !errors.Is(err, hm.ErrLimitExceeded) {
+			t.Errorf("limit %d (stream): expected ErrLimitExceeded, got %v", i, err)
+		}
+	}
+}
+
+func TestDefaultValueLimit(t *testing.T) {
+	// Each DUP and CONCAT pair doubles the value on the stack.
+	ops := []*hashmachine.Op{{Opcode: hashmachine.OpCode_OPCODE_PUSH_BYTES, Payload: make([]byte, 32)}}
+	for i := 0; i < 30; i++ {
+		ops = append(ops,
+			&hashmachine.Op{Opcode: hashmachine.OpCode_OPCODE_DUP, Index: 0},
+			&hashmachine.Op{Opcode: hashmachine.OpCode_OPCODE_CONCAT, Index: 2},
+		)
+	}
+	p := &hashmachine.Program{
+		Metadata: &hashmachine.ProgramMetadata{HashConfig: bInO.Metadata.HashConfig},
+		Ops:      ops,
+	}
+	if err := hm.Validate(p); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := hm.Verify(p, nil, nil); !errors.Is(err, hm.ErrLimitExceeded) {
+		t.Errorf("expected ErrLimitExceeded, got %v", err)
+	}
+}
+
+func TestStreamHugeMessage(t *testing.T) {
+	// A length prefix of 1<<62 must be rejected without allocating.
+	huge := protowire.AppendVarint(nil, 1<<62)
+	for _, limits := range []hm.Limits{{}, {MaxMessageBytes: 1 << 30}} {
+		d := hm.NewDecoder(bytes.NewReader(huge), hm.WithLimits(limits))
+		if _, err := d.Metadata(); !errors.Is(err, hm.ErrLimitExceeded) {
+			t.Errorf("%+v: expected ErrLimitExceeded, got %v", limits, err)
+		}
+	}
+
+	// A length prefix within limits but longer than the stream is truncated.
+	short := append(protowire.AppendVarint(nil, 1<<20), 0x08, 0x01)
+	d := hm.NewDecoder(bytes.NewReader(short))
+	if _, err := d.Metadata(); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("expected io.ErrUnexpectedEOF, got %v", err)
+	}
+}
+
+func TestOutputs(t *testing.T) {
+	ok, err := hm.VerifyOutputs(checkpoints, nil, [][]byte{mmr1, mmr2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ok {
+		t.Error("checkpoints: unequal outputs")
+	}
+	ok, err = hm.VerifyOutputs(checkpoints, nil, [][]byte{mmr2, mmr1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok {
+		t.Error("checkpoints: expected mismatch with swapped outputs")
+	}
+	if _, err := hm.VerifyOutputs(checkpoints, nil, [][]byte{mmr1}); err == nil {
+		t.Error("expected error for wrong output count")
+	}
+	if _, err := hm.Verify(checkpoints, nil, mmr2); err == nil {
+		t.Error("expected error verifying multi-output program with Verify")
+	}
+
+	// Legacy programs have a single output.
+	ok, err = hm.VerifyOutputs(consistency, [][]byte{mmr1}, [][]byte{mmr2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ok {
+		t.Error("consistency: unequal output")
+	}
+}
+
+func TestInvalidOutputs(t *testing.T) {
+	md := checkpoints.Metadata
+	progs := map[string][]*hashmachine.Op{
+		"unmatched": {
+			{Opcode: hashmachine.OpCode_OPCODE_PUSH_BYTES, Payload: mmr1},
+			{Opcode: hashmachine.OpCode_OPCODE_MATCH_OUTPUT, Index: 0},
+		},
+		"matched twice": {
+			{Opcode: hashmachine.OpCode_OPCODE_PUSH_BYTES, Payload: mmr1},
+			{Opcode: hashmachine.OpCode_OPCODE_MATCH_OUTPUT, Index: 0},
+			{Opcode: hashmachine.OpCode_OPCODE_PUSH_BYTES, Payload: mmr1},
+			{Opcode: hashmachine.OpCode_OPCODE_MATCH_OUTPUT, Index: 0},
+		},
+		"leftover": {
+			{Opcode: hashmachine.OpCode_OPCODE_PUSH_BYTES, Payload: o},
+			{Opcode: hashmachine.OpCode_OPCODE_PUSH_BYTES, Payload: mmr1},
+			{Opcode: hashmachine.OpCode_OPCODE_MATCH_OUTPUT, Index: 0},
+			{Opcode: hashmachine.OpCode_OPCODE_PUSH_BYTES, Payload: mmr2},
+			{Opcode: hashmachine.OpCode_OPCODE_MATCH_OUTPUT, Index: 1},
+		},
+		"out of bounds": {
+			{Opcode: hashmachine.OpCode_OPCODE_PUSH_BYTES, Payload: mmr1},
+			{Opcode: hashmachine.OpCode_OPCODE_MATCH_OUTPUT, Index: 2},
+		},
+	}
+	for name, ops := range progs {
+		p := &hashmachine.Program{Metadata: md, Ops: ops}
+		if _, err := hm.VerifyOutputs(p, nil, [][]byte{mmr1, mmr2}); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+	noMetadata := &hashmachine.Program{Ops: checkpoints.Ops}
+	if _, err := hm.VerifyOutputs(noMetadata, nil, [][]byte{mmr1, mmr2}); err == nil {
+		t.Error("expected error for program without metadata")
+	}
+}
+
+func TestAnchorMismatch(t *testing.T) {
+	_, err := hm.Verify(anchored(mmr2), nil, mmr2)
+	var ae *hm.AnchorError
+	if !errors.As(err, &ae) {
+		t.Fatalf("expected AnchorError, got %v", err)
+	}
+	if ae.Op != 4 || len(ae.Path) != 0 || !bytes.Equal(ae.Got, mmr1) || !bytes.Equal(ae.Want, mmr2) {
+		t.Errorf("unexpected AnchorError: %v", ae)
+	}
+
+	// Anchors in subroutines are located by the call and a path within it.
+	p := &hashmachine.Program{
+		Metadata: hashN.Metadata,
+		Ops: []*hashmachine.Op{
+			{Opcode: hashmachine.OpCode_OPCODE_PUSH_BYTES, Payload: a},
+			{Opcode: hashmachine.OpCode_OPCODE_CALL, Index: 1},
+			{Opcode: hashmachine.OpCode_OPCODE_PUSH_BYTES, Payload: b},
+			{Opcode: hashmachine.OpCode_OPCODE_CALL, Index: 1},
+			{Opcode: hashmachine.OpCode_OPCODE_PUSH_BYTES, Payload: a},
+		},
+		Subroutines: []*hashmachine.Subroutine{
+			{Ops: []*hashmachine.Op{{Opcode: hashmachine.OpCode_OPCODE_MATCH_BYTES, Payload: a}}},
+			{Ops: []*hashmachine.Op{
+				{Opcode: hashmachine.OpCode_OPCODE_DUP},
+				{Opcode: hashmachine.OpCode_OPCODE_DROP},
+				{Opcode: hashmachine.OpCode_OPCODE_CALL, Index: 0},
+			}},
+		},
+	}
+	_, err = hm.Verify(p, nil, a)
+	if !errors.As(err, &ae) {
+		t.Fatalf("expected AnchorError, got %v", err)
+	}
+	want := []hm.SubroutineOp{{Subroutine: 1, Op: 2}, {Subroutine: 0, Op: 0}}
+	if ae.Op != 3 || !reflect.DeepEqual(ae.Path, want) || !bytes.Equal(ae.Got, b) {
+		t.Errorf("unexpected AnchorError: %v", ae)
+	}
+}
+
+func TestSliceOutOfRange(t *testing.T) {
+	if _, err := hm.Verify(slice, [][]byte{[]byte("")}, nil); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	p := &hashmachine.Program{
+		Metadata: slice.Metadata,
+		Ops: []*hashmachine.Op{
+			{Opcode: hashmachine.OpCode_OPCODE_PUSH_INPUT, Index: 0},
+			{Opcode: hashmachine.OpCode_OPCODE_SLICE, Index: 1, Length: 1},
+		},
+	}
+	if _, err := hm.Verify(p, [][]byte{b}, nil); err == nil {
+		t.Error("expected error for slice out of range")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	for i, tc := range testCases {
+		if err := hm.Validate(tc.p); err != nil {
+			t.Errorf("test case %d: %v", i, err)
+		}
+	}
+	if err := hm.Validate(checkpoints); err != nil {
+		t.Errorf("checkpoints: %v", err)
+	}
+
+	md := &hashmachine.ProgramMetadata{
+		HashConfig: &hashmachine.HashConfig{
+			HashFunction: hashmachine.HashFunction_HASHFUNCTION_SHA_256,
+		},
+		ExpectedInputCount: 1,
+	}
+	invalid := map[string][]*hashmachine.Op{
+		"underflow": {
+			{Opcode: hashmachine.OpCode_OPCODE_PUSH_INPUT, Index: 0},
+			{Opcode: hashmachine.OpCode_OPCODE_SWAP, Index: 1},
+		},
+		"swap zero": {
+			{Opcode: hashmachine.OpCode_OPCODE_PUSH_INPUT, Index: 0},
+			{Opcode: hashmachine.OpCode_OPCODE_DUP, Index: 0},
+			{Opcode: hashmachine.OpCode_OPCODE_SWAP, Index: 0},
+			{Opcode: hashmachine.OpCode_OPCODE_DROP},
+		},
+		"unused input": {
+			{Opcode: hashmachine.OpCode_OPCODE_PUSH_BYTES, Payload: a},
+		},
+		"input used twice": {
+			{Opcode: hashmachine.OpCode_OPCODE_PUSH_INPUT, Index: 0},
+			{Opcode: hashmachine.OpCode_OPCODE_PUSH_INPUT, Index: 0},
+			{Opcode: hashmachine.OpCode_OPCODE_DROP},
+		},
+		"leftover": {
+			{Opcode: hashmachine.OpCode_OPCODE_PUSH_INPUT, Index: 0},
+			{Opcode: hashmachine.OpCode_OPCODE_DUP, Index: 0},
+		},
+		"no branching factor": {
+			{Opcode: hashmachine.OpCode_OPCODE_PUSH_INPUT, Index: 0},
+			{Opcode: hashmachine.OpCode_OPCODE_POP_CHILDREN_PUSH_HASH},
+		},
+		"unknown opcode": {
+			{Opcode: hashmachine.OpCode_OPCODE_INVALID},
+		},
+	}
+	for name, ops := range invalid {
+		p := &hashmachine.Program{Metadata: md, Ops: ops}
+		if err := hm.Validate(p); err == nil {
+			t.Errorf("%s: expected Validate error", name)
+		}
+	}
+
+	// Step reports underflow as an error.
+	if _, err := hm.Verify(&hashmachine.Program{Metadata: md, Ops: invalid["underflow"]}, [][]byte{b}, nil); err == nil {
+		t.Error("underflow: expected Verify error")
+	}
+}
+
+func TestMaxHashes(t *testing.T) {
+	opt := hm.WithLimits(hm.Limits{MaxHashes: 999})
+	if _, err := hm.Verify(chain, [][]byte{b}, nil, opt); !errors.Is(err, hm.ErrLimitExceeded) {
+		t.Errorf("expected ErrLimitExceeded, got %v", err)
+	}
+	if err := hm.Validate(chain, opt); !errors.Is(err, hm.ErrLimitExceeded) {
+		t.Errorf("expected ErrLimitExceeded from Validate, got %v", err)
+	}
+	opt = hm.WithLimits(hm.Limits{MaxHashes: 1000})
+	if _, err := hm.Verify(chain, [][]byte{b}, nil, opt); err != nil {
+		t.Error(err)
+	}
+
+	// Long hash chains are bounded by default.
+	long := &hashmachine.Program{
+		Metadata: chain.Metadata,
+		Ops: []*hashmachine.Op{
+			{Opcode: hashmachine.OpCode_OPCODE_PUSH_INPUT, Index: 0},
+			{Opcode: hashmachine.OpCode_OPCODE_REPEAT_HASH, Index: 1<<31 - 1},
+		},
+	}
+	if err := hm.Validate(long); !errors.Is(err, hm.ErrLimitExceeded) {
+		t.Errorf("expected ErrLimitExceeded from Validate, got %v", err)
+	}
+	if _, err := hm.Verify(long, [][]byte{b}, nil); !errors.Is(err, hm.ErrLimitExceeded) {
+		t.Errorf("expected ErrLimitExceeded, got %v", err)
+	}
+}
+
+func TestCompact(t *testing.T) {
+	for i, tc := range testCases {
+		ok, err := hm.Verify(hm.Compact(tc.p), tc.inputs, tc.output)
+		if err != nil {
+			t.Errorf("test case %d: %v", i, err)
+		} else if !ok {
+			t.Errorf("test case %d: unequal output", i)
+		}
+	}
+
+	repeated := &hashmachine.Program{
+		Metadata: bInO.Metadata,
+		Ops: []*hashmachine.Op{
+			{Opcode: hashmachine.OpCode_OPCODE_PUSH_BYTES, Payload: o},
+			{Opcode: hashmachine.OpCode_OPCODE_PUSH_BYTES, Payload: o},
+			{Opcode: hashmachine.OpCode_OPCODE_PUSH_INPUT, Index: 0},
+			{Opcode: hashmachine.OpCode_OPCODE_POP_N_PUSH_HASH, Index: 3},
+			{Opcode: hashmachine.OpCode_OPCODE_PUSH_BYTES, Payload: o},
+			{Opcode: hashmachine.OpCode_OPCODE_POP_CHILDREN_PUSH_HASH},
+		},
+	}
+	_, want, err := hm.VerifyWithOutput(repeated, [][]byte{b}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	compact := hm.Compact(repeated)
+	if len(compact.Literals) != 1 {
+		t.Errorf("expected 1 literal, got %d", len(compact.Literals))
+	}
+	if err := hm.Validate(compact); err != nil {
+		t.Error(err)
+	}
+	if proto.Size(compact) >= proto.Size(repeated) {
+		t.Errorf("compacted program is not smaller: %d >= %d bytes", proto.Size(compact), proto.Size(repeated))
+	}
+	var buf bytes.Buffer
+	if err := hm.WriteStream(&buf, compact); err != nil {
+		t.Fatal(err)
+	}
+	ok, err := hm.VerifyStream(&buf, bytesInputs([][]byte{b}), want)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ok {
+		t.Error("compacted program: unequal output")
+	}
+
+	// Literals are shared by ops that select different hash configs, and
+	// each op keeps its hash config.
+	mixed := &hashmachine.Program{
+		Metadata: crossDomain.Metadata,
+		Ops: []*hashmachine.Op{
+			{Opcode: hashmachine.OpCode_OPCODE_PUSH_BYTES, Payload: o},
+			{Opcode: hashmachine.OpCode_OPCODE_PUSH_BYTES, Payload: o},
+			{Opcode: hashmachine.OpCode_OPCODE_PUSH_BYTES, Payload: o, HashConfig: 1},
+			{Opcode: hashmachine.OpCode_OPCODE_PUSH_BYTES, Payload: o, HashConfig: 1},
+		},
+	}
+	compact = hm.Compact(mixed)
+	if len(compact.Literals) != 1 {
+		t.Errorf("expected 1 literal, got %d", len(compact.Literals))
+	}
+	for i, op := range compact.Ops {
+		if op.HashConfig != mixed.Ops[i].HashConfig {
+			t.Errorf("op %d: hash config %d, want %d", i, op.HashConfig, mixed.Ops[i].HashConfig)
+		}
+	}
+}
+
+func TestSubroutines(t *testing.T) {
+	// Ops in subroutines count towards MaxOps once per call.
+	opt := hm.WithLimits(hm.Limits{MaxOps: 8})
+	if _, err := hm.Verify(consistencySub, [][]byte{mmr1}, mmr2, opt); !errors.Is(err, hm.ErrLimitExceeded) {
+		t.Errorf("expected ErrLimitExceeded, got %v", err)
+	}
+	if err := hm.Validate(consistencySub, opt); !errors.Is(err, hm.ErrLimitExceeded) {
+		t.Errorf("expected ErrLimitExceeded from Validate, got %v", err)
+	}
+
+	invalid := map[string]*hashmachine.Program{
+		"recursive": {
+			Metadata: hashN.Metadata,
+			Ops:      []*hashmachine.Op{{Opcode: hashmachine.OpCode_OPCODE_CALL, Index: 0}},
+			Subroutines: []*hashmachine.Subroutine{
+				{Ops: []*hashmachine.Op{{Opcode: hashmachine.OpCode_OPCODE_CALL, Index: 0}}},
+			},
+		},
+		"out of bounds": {
+			Metadata: hashN.Metadata,
+			Ops:      []*hashmachine.Op{{Opcode: hashmachine.OpCode_OPCODE_CALL, Index: 1}},
+			Subroutines: []*hashmachine.Subroutine{
+				{Ops: []*hashmachine.Op{{Opcode: hashmachine.OpCode_OPCODE_PUSH_BYTES, Payload: a}}},
+			},
+		},
+	}
+	for name, p := range invalid {
+		if err := hm.Validate(p); err == nil {
+			t.Errorf("%s: expected Validate error", name)
+		}
+		if _, err := hm.Verify(p, nil, a); err == nil {
+			t.Errorf("%s: expected Verify error", name)
+		}
+	}
+}
+
+// doubling returns a program whose n subroutines each call the previous
+// subroutine twice, so that the program expands to about 2^n ops.
+func doubling(n int, typed bool) *hashmachine.Program {
+	p := &hashmachine.Program{
+		Metadata: &hashmachine.ProgramMetadata{
+			HashConfig: hashN.Metadata.HashConfig,
+			TypedStack: typed,
+		},
+		Ops: []*hashmachine.Op{
+			{Opcode: hashmachine.OpCode_OPCODE_PUSH_BYTES, Payload: a},
+			{Opcode: hashmachine.OpCode_OPCODE_CALL, Index: uint64(n - 1)},
+		},
+		Subroutines: []*hashmachine.Subroutine{{Ops: []*hashmachine.Op{
+			{Opcode: hashmachine.OpCode_OPCODE_DUP},
+			{Opcode: hashmachine.OpCode_OPCODE_DROP},
+		}}},
+	}
+	for i := 1; i < n; i++ {
+		call := &hashmachine.Op{Opcode: hashmachine.OpCode_OPCODE_CALL, Index: uint64(i - 1)}
+		p.Subroutines = append(p.Subroutines, &hashmachine.Subroutine{Ops: []*hashmachine.Op{call, call}})
+	}
+	return p
+}
+
+func TestSubroutineExpansion(t *testing.T) {
+	// Each subroutine is validated once, however often it is called.
+	for _, typed := range []bool{false, true} {
+		if err := hm.Validate(doubling(20, typed)); err != nil {
+			t.Errorf("typed %v: %v", typed, err)
+		}
+	}
+
+	// Programs that expand to too many ops are rejected up front, even
+	// without limits.
+	huge := doubling(40, false)
+	if err := hm.Validate(huge); !errors.Is(err, hm.ErrLimitExceeded) {
+		t.Errorf("expected ErrLimitExceeded from Validate, got %v", err)
+	}
+	if _, err := hm.Verify(huge, nil, a); !errors.Is(err, hm.ErrLimitExceeded) {
+		t.Errorf("expected ErrLimitExceeded from Verify, got %v", err)
+	}
+
+	// Errors in subroutines are found wherever they are called.
+	underflow := doubling(3, false)
+	underflow.Ops = underflow.Ops[1:]
+	typeError := doubling(3, true)
+	typeError.Metadata.ExpectedInputCount = 1
+	typeError.Ops[0] = &hashmachine.Op{Opcode: hashmachine.OpCode_OPCODE_PUSH_INPUT_HASHED, Index: 0}
+	typeError.Subroutines[0].Ops = []*hashmachine.Op{
+		{Opcode: hashmachine.OpCode_OPCODE_PUSH_BYTES, Payload: a},
+		{Opcode: hashmachine.OpCode_OPCODE_CONCAT, Index: 2}, // of a leaf digest
+	}
+	for name, tc := range map[string]struct {
+		p    *hashmachine.Program
+		want string
+	}{
+		"underflow":  {underflow, "stack underflow"},
+		"type error": {typeError, "cannot take leaf digest"},
+	} {
+		if err := hm.Validate(tc.p); err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("%s: expected Validate error containing %q, got %v", name, tc.want, err)
+		}
+	}
+}
+
+// bInOTemplate is the shape of bInO with its siblings as parameters.
+var bInOTemplate *hashmachine.Template = &hashmachine.Template{
+	Program: &hashmachine.Program{
+		Metadata: bInO.Metadata,
+		Ops: []*hashmachine.Op{
+			{Opcode: hashmachine.OpCode_OPCODE_PUSH_PARAM, Index: 0},
+			{Opcode: hashmachine.OpCode_OPCODE_PUSH_INPUT, Index: 0},
+			{Opcode: hashmachine.OpCode_OPCODE_POP_CHILDREN_PUSH_HASH},
+			{Opcode: hashmachine.OpCode_OPCODE_PUSH_PARAM, Index: 1},
+			{Opcode: hashmachine.OpCode_OPCODE_POP_CHILDREN_PUSH_HASH},
+			{Opcode: hashmachine.OpCode_OPCODE_PUSH_PARAM, Index: 2},
+			{Opcode: hashmachine.OpCode_OPCODE_POP_CHILDREN_PUSH_HASH},
+		},
+	},
+	Params: []hashmachine.ParamType{
+		hashmachine.ParamType_PARAMTYPE_BYTES,
+		hashmachine.ParamType_PARAMTYPE_DIGEST,
+		hashmachine.ParamType_PARAMTYPE_DIGEST,
+	},
+}
+
+func TestTemplates(t *testing.T) {
+	if err := hm.ValidateTemplate(bInOTemplate); err != nil {
+		t.Fatal(err)
+	}
+	if err := hm.Validate(bInOTemplate.Program); err == nil {
+		t.Error("expected Validate error for template program")
+	}
+	if _, err := hm.Verify(bInOTemplate.Program, [][]byte{b}, o); err == nil {
+		t.Error("expected error executing uninstantiated template")
+	}
+
+	p, err := hm.Instantiate(bInOTemplate, [][]byte{a, f, n})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !proto.Equal(p, bInO) {
+		t.Errorf("instantiated template differs from bInO: %v", p)
+	}
+	if err := hm.Validate(p); err != nil {
+		t.Error(err)
+	}
+	ok, err := hm.Verify(p, [][]byte{b}, o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ok {
+		t.Error("instantiated template: unequal output")
+	}
+
+	badParams := map[string][][]byte{
+		"too few":      {a, f},
+		"too many":     {a, f, n, n},
+		"short digest": {a, a, n},
+	}
+	for name, params := range badParams {
+		if _, err := hm.Instantiate(bInOTemplate, params); err == nil {
+			t.Errorf("%s: expected Instantiate error", name)
+		}
+	}
+
+	invalid := map[string]*hashmachine.Template{
+		"out of bounds": {
+			Program: &hashmachine.Program{
+				Metadata: hashN.Metadata,
+				Ops:      []*hashmachine.Op{{Opcode: hashmachine.OpCode_OPCODE_PUSH_PARAM, Index: 1}},
+			},
+			Params: []hashmachine.ParamType{hashmachine.ParamType_PARAMTYPE_BYTES},
+		},
+		"unknown type": {
+			Program: &hashmachine.Program{
+				Metadata: hashN.Metadata,
+				Ops:      []*hashmachine.Op{{Opcode: hashmachine.OpCode_OPCODE_PUSH_PARAM, Index: 0}},
+			},
+			Params: []hashmachine.ParamType{hashmachine.ParamType_PARAMTYPE_UNKNOWN},
+		},
+		"no program": {},
+	}
+	for name, tmpl := range invalid {
+		if err := hm.ValidateTemplate(tmpl); err == nil {
+			t.Errorf("%s: expected ValidateTemplate error", name)
+		}
+	}
+}
+
+func TestTemplateHashConfigs(t *testing.T) {
+	// A digest parameter pushed for a 64-byte hash config is 64 bytes long.
+	tmpl := &hashmachine.Template{
+		Program: &hashmachine.Program{
+			Metadata: &hashmachine.ProgramMetadata{
+				HashConfig: crossDomain.Metadata.HashConfig,
+				HashConfigs: []*hashmachine.HashConfig{
+					{HashFunction: hashmachine.HashFunction_HASHFUNCTION_SHA3_512, HashOutputLengthBytes: 64},
+				},
+				ExpectedInputCount: 1,
+			},
+			Ops: []*hashmachine.Op{
+				{Opcode: hashmachine.OpCode_OPCODE_PUSH_PARAM, Index: 0, HashConfig: 1},
+				{Opcode: hashmachine.OpCode_OPCODE_PUSH_INPUT_HASHED, Index: 0, HashConfig: 1},
+				{Opcode: hashmachine.OpCode_OPCODE_POP_N_PUSH_HASH, Index: 2, HashConfig: 1},
+			},
+		},
+		Params: []hashmachine.ParamType{hashmachine.ParamType_PARAMTYPE_DIGEST},
+	}
+	p, err := hm.Instantiate(tmpl, [][]byte{make([]byte, 64)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := p.Ops[0].HashConfig; got != 1 {
+		t.Errorf("instantiated op selects hash config %d, want 1", got)
+	}
+	if _, err := hm.Instantiate(tmpl, [][]byte{make([]byte, 32)}); err == nil {
+		t.Error("expected Instantiate error for digest sized by the default hash config")
+	}
+}
+
+const (
+	opHashPair hashmachine.OpCode = hm.MinVendorOpCode + iota
+	opBadPushes
+)
+
+func init() {
+	// opHashPair hashes the top two values in pop order, like
+	// OPCODE_POP_CHILDREN_PUSH_HASH in a binary tree.
+	hm.RegisterOp(opHashPair, hm.OpSpec{
+		Pops:   2,
+		Pushes: 1,
+		Hashes: 1,
+		Func: func(op *hashmachine.Op, h oncehash.Hash, args [][]byte) ([][]byte, error) {
+			h.Reset()
+			for _, a := range args {
+				h.Write(a)
+			}
+			return [][]byte{h.Sum(nil)}, nil
+		},
+	})
+	hm.RegisterOp(opBadPushes, hm.OpSpec{
+		Pops:   1,
+		Pushes: 1,
+		Func: func(op *hashmachine.Op, h oncehash.Hash, args [][]byte) ([][]byte, error) {
+			return nil, nil
+		},
+	})
+}
+
+func vendorProgram(opcode hashmachine.OpCode) *hashmachine.Program {
+	return &hashmachine.Program{
+		Metadata: hashInput2.Metadata,
+		Ops: []*hashmachine.Op{
+			{Opcode: hashmachine.OpCode_OPCODE_PUSH_INPUT, Index: 0},
+			{Opcode: hashmachine.OpCode_OPCODE_PUSH_INPUT, Index: 1},
+			{Opcode: opcode},
+		},
+	}
+}
+
+func TestVendorOps(t *testing.T) {
+	p := vendorProgram(opHashPair)
+	if err := hm.Validate(p); err != nil {
+		t.Fatal(err)
+	}
+	ok, err := hm.Verify(p, [][]byte{a, b}, c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ok {
+		t.Error("vendor op: unequal output")
+	}
+	if _, err := hm.Verify(p, [][]byte{a, b}, c, hm.WithLimits(hm.Limits{MaxHashes: 1})); err != nil {
+		t.Error(err)
+	}
+	var traced []hashmachine.OpCode
+	trace := hm.WithTrace(func(op *hashmachine.Op, stack [][]byte) { traced = append(traced, op.Opcode) })
+	if _, err := hm.Verify(p, [][]byte{a, b}, c, trace); err != nil {
+		t.Error(err)
+	}
+	if len(traced) != len(p.Ops) || traced[len(traced)-1] != opHashPair {
+		t.Errorf("vendor op not traced: %v", traced)
+	}
+	p.Ops = append(p.Ops, &hashmachine.Op{Opcode: hashmachine.OpCode_OPCODE_DUP}, &hashmachine.Op{Opcode: opHashPair})
+	if _, err := hm.Verify(p, [][]byte{a, b}, nil, hm.WithLimits(hm.Limits{MaxHashes: 1})); !errors.Is(err, hm.ErrLimitExceeded) {
+		t.Errorf("expected ErrLimitExceeded, got %v", err)
+	}
+
+	// Declared stack effects are checked statically.
+	underflow := &hashmachine.Program{
+		Metadata: hashInput.Metadata,
+		Ops: []*hashmachine.Op{
+			{Opcode: hashmachine.OpCode_OPCODE_PUSH_INPUT, Index: 0},
+			{Opcode: opHashPair},
+		},
+	}
+	if err := hm.Validate(underflow); err == nil {
+		t.Error("expected Validate error for vendor op stack underflow")
+	}
+
+	unregistered := vendorProgram(hm.MaxVendorOpCode)
+	if err := hm.Validate(unregistered); err == nil || !strings.Contains(err.Error(), "unregistered vendor opcode") {
+		t.Errorf("expected unregistered vendor opcode error from Validate, got %v", err)
+	}
+	if _, err := hm.Verify(unregistered, [][]byte{a, b}, c); err == nil || !strings.Contains(err.Error(), "unregistered vendor opcode") {
+		t.Errorf("expected unregistered vendor opcode error from Verify, got %v", err)
+	}
+
+	if _, err := hm.Verify(vendorProgram(opBadPushes), [][]byte{a, b}, c); err == nil {
+		t.Error("expected error for vendor op pushing fewer values than declared")
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("expected panic registering opcode outside vendor range")
+		}
+	}()
+	hm.RegisterOp(hashmachine.OpCode_OPCODE_DROP, hm.OpSpec{Func: func(*hashmachine.Op, oncehash.Hash, [][]byte) ([][]byte, error) { return nil, nil }})
+}
+
+// crossDomain hashes its input with SHAKE256 and includes the result in a
+// SHA-256 tree.
+var crossDomain *hashmachine.Program = &hashmachine.Program{
+	Metadata: &hashmachine.ProgramMetadata{
+		HashConfig: &hashmachine.HashConfig{
+			HashFunction: hashmachine.HashFunction_HASHFUNCTION_SHA_256,
+		},
+		HashConfigs: []*hashmachine.HashConfig{
+			{HashFunction: hashmachine.HashFunction_HASHFUNCTION_SHA3_512, HashOutputLengthBytes: 32},
+		},
+		ExpectedInputCount: 1,
+		BranchingFactor:    2,
+	},
+	Ops: []*hashmachine.Op{
+		{Opcode: hashmachine.OpCode_OPCODE_PUSH_BYTES, Payload: a},
+		{Opcode: hashmachine.OpCode_OPCODE_PUSH_INPUT_HASHED, Index: 0, HashConfig: 1},
+		{Opcode: hashmachine.OpCode_OPCODE_POP_CHILDREN_PUSH_HASH},
+	},
+}
+
+func TestHashConfigs(t *testing.T) {
+	leaf := make([]byte, 32)
+	sha3.ShakeSum256(leaf, b)
+	want := sha256.Sum256(append(leaf, a...))
+
+	if err := hm.Validate(crossDomain); err != nil {
+		t.Fatal(err)
+	}
+	ok, err := hm.Verify(crossDomain, [][]byte{b}, want[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ok {
+		t.Error("cross-domain program: unequal output")
+	}
+
+	badIndex := proto.Clone(crossDomain).(*hashmachine.Program)
+	badIndex.Ops[1].HashConfig = 2
+	badConfig := proto.Clone(crossDomain).(*hashmachine.Program)
+	badConfig.Metadata.HashConfigs = append(badConfig.Metadata.HashConfigs, &hashmachine.HashConfig{
+		HashFunction: hashmachine.HashFunction_HASHFUNCTION_SHA3_512, // missing output length
+	})
+	nilConfig := proto.Clone(crossDomain).(*hashmachine.Program)
+	nilConfig.Metadata.HashConfigs = append(nilConfig.Metadata.HashConfigs, nil)
+	unknownFunction := proto.Clone(crossDomain).(*hashmachine.Program)
+	unknownFunction.Metadata.HashConfigs[0].HashFunction = 99
+	noDefault := proto.Clone(crossDomain).(*hashmachine.Program)
+	noDefault.Metadata.HashConfig = nil
+	for name, p := range map[string]*hashmachine.Program{
+		"bad index":        badIndex,
+		"bad config":       badConfig,
+		"nil config":       nilConfig,
+		"unknown function": unknownFunction,
+		"no default":       noDefault,
+	} {
+		if err := hm.Validate(p); err == nil {
+			t.Errorf("%s: expected Validate error", name)
+		}
+		if _, err := hm.Verify(p, [][]byte{b}, want[:]); err == nil {
+			t.Errorf("%s: expected Verify error", name)
+		}
+	}
+	// Unused configs are validated up front.
+	if _, err := hm.New(badConfig, [][]byte{b}); err == nil {
+		t.Error("expected New error for invalid unused hash config")
+	}
+}
+
+func TestVerifyMulti(t *testing.T) {
+	configs := []*hashmachine.HashConfig{
+		hashInput2.Metadata.HashConfig,
+		{HashFunction: hashmachine.HashFunction_HASHFUNCTION_SHA3_512, HashOutputLengthBytes: 32},
+	}
+	shake := make([]byte, 32)
+	sha3.ShakeSum256(shake, []byte("ba"))
+	ok, err := hm.VerifyMulti(hashInput2, configs, [][]byte{a, b}, [][]byte{c, shake})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ok {
+		t.Error("unequal outputs")
+	}
+	if ok, _ := hm.VerifyMulti(hashInput2, configs, [][]byte{a, b}, [][]byte{c, c}); ok {
+		t.Error("verified wrong output")
+	}
+	if _, err := hm.VerifyMulti(hashInput2, configs, [][]byte{a, b}, [][]byte{c}); err == nil {
+		t.Error("expected error for mismatched output count")
+	}
+	noMetadata := &hashmachine.Program{Ops: hashInput2.Ops}
+	if _, err := hm.VerifyMulti(noMetadata, configs, [][]byte{a, b}, [][]byte{c, shake}); err == nil {
+		t.Error("expected error for program without metadata")
+	}
+	if _, err := hm.Verify(noMetadata, [][]byte{a, b}, c); err == nil {
+		t.Error("expected Verify error for program without metadata")
+	}
+}
+
+func TestTruncatedHash(t *testing.T) {
+	p := proto.Clone(hashInput2).(*hashmachine.Program)
+	p.Metadata.HashConfig.TruncateOutputBytes = 20
+	ok, err := hm.Verify(p, [][]byte{a, b}, c[:20])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ok {
+		t.Error("truncated hash: unequal output")
+	}
+
+	p.Metadata.HashConfig.TruncateOutputBytes = 33
+	if err := hm.Validate(p); err == nil {
+		t.Error("expected Validate error for truncation longer than SHA-256 output")
+	}
+	if _, err := hm.Verify(p, [][]byte{a, b}, c); err == nil {
+		t.Error("expected Verify error for truncation longer than SHA-256 output")
+	}
+}
+
+func TestHMAC(t *testing.T) {
+	key := []byte("secret")
+	p := proto.Clone(hashInput2).(*hashmachine.Program)
+	p.Metadata.HashConfig.Hmac = true
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte("ba"))
+	want := mac.Sum(nil)
+
+	if err := hm.Validate(p); err != nil {
+		t.Fatal(err)
+	}
+	ok, err := hm.Verify(p, [][]byte{a, b}, want, hm.WithHMACKey(key))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ok {
+		t.Error("HMAC: unequal output")
+	}
+	if ok, _ := hm.Verify(p, [][]byte{a, b}, want, hm.WithHMACKey([]byte("wrong"))); ok {
+		t.Error("HMAC: verified with wrong key")
+	}
+	if _, err := hm.Verify(p, [][]byte{a, b}, want); err == nil {
+		t.Error("expected error verifying HMAC program without a key")
+	}
+
+	p.Metadata.HashConfig = &hashmachine.HashConfig{
+		HashFunction:          hashmachine.HashFunction_HASHFUNCTION_SHA3_512,
+		HashOutputLengthBytes: 32,
+		Hmac:                  true,
+	}
+	if err := hm.Validate(p); err == nil {
+		t.Error("expected Validate error for HMAC with variable-length hash function")
+	}
+}
+
+func TestNodePosition(t *testing.T) {
+	p := &hashmachine.Program{
+		Metadata: &hashmachine.ProgramMetadata{
+			HashConfig: &hashmachine.HashConfig{
+				HashFunction: hashmachine.HashFunction_HASHFUNCTION_SHA_256,
+				NodePosition: hashmachine.NodePosition_NODEPOSITION_INDEX,
+			},
+			BranchingFactor: 2,
+		},
+		Ops: []*hashmachine.Op{
+			{Opcode: hashmachine.OpCode_OPCODE_PUSH_BYTES, Payload: a},
+			{Opcode: hashmachine.OpCode_OPCODE_PUSH_BYTES, Payload: b},
+			{Opcode: hashmachine.OpCode_OPCODE_POP_CHILDREN_PUSH_HASH, Index: 5},
+		},
+	}
+	want := sha256.Sum256(append(hm.EncodePosition(5), "ba"...))
+	ok, err := hm.Verify(p, nil, want[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ok {
+		t.Error("unequal output")
+	}
+	p.Ops[2].Index = 6
+	if ok, _ := hm.Verify(p, nil, want[:]); ok {
+		t.Error("verified with wrong position")
+	}
+
+	p.Metadata.HashConfig.NodePosition = 99
+	if err := hm.Validate(p); err == nil {
+		t.Error("expected Validate error for unknown node position")
+	}
+}
+
+func typed(p *hashmachine.Program) *hashmachine.Program {
+	r := proto.Clone(p).(*hashmachine.Program)
+	r.Metadata.TypedStack = true
+	return r
+}
+
+func TestTypedStack(t *testing.T) {
+	// Well-typed programs verify as usual.
+	for _, tc := range []testCase{
+		{typed(hashedInput), [][]byte{b}, DecodeBase64OrDie("PiPoFgA5WUoziU9lZOGxNIu9egCI1CxKy3PurtWcAJ0")},
+		{typed(hashInput2), [][]byte{a, b}, c},
+		{typed(hashN), nil, DecodeBase64OrDie("KCv+8LPxgJomsdbjPurWgEjfk1D76sQqR0c4z53/K/g")},
+		{typed(gitBlob), [][]byte{[]byte("hello")}, DecodeBase64OrDie("iuxOSHb4VPaI0Ov8jzdZjzjl/WkDzMyFDKNlkRda62A")},
+	} {
+		if err := hm.Validate(tc.p); err != nil {
+			t.Errorf("%v: %v", tc.p.Ops, err)
+			continue
+		}
+		ok, err := hm.Verify(tc.p, tc.inputs, tc.output)
+		if err != nil {
+			t.Errorf("%v: %v", tc.p.Ops, err)
+		}
+		if !ok {
+			t.Errorf("%v: unequal output", tc.p.Ops)
+		}
+	}
+
+	ill := map[string]*hashmachine.Program{
+		// bInO hashes its input directly as a tree node.
+		"input as child": typed(bInO),
+		"input with digest": {
+			Metadata: &hashmachine.ProgramMetadata{
+				HashConfig:         hashInput.Metadata.HashConfig,
+				ExpectedInputCount: 1,
+				TypedStack:         true,
+			},
+			Ops: []*hashmachine.Op{
+				{Opcode: hashmachine.OpCode_OPCODE_PUSH_INPUT, Index: 0},
+				{Opcode: hashmachine.OpCode_OPCODE_DUP},
+				{Opcode: hashmachine.OpCode_OPCODE_POP_N_PUSH_HASH, Index: 1}, // leaf
+				{Opcode: hashmachine.OpCode_OPCODE_POP_N_PUSH_HASH, Index: 2}, // leaf and input
+			},
+		},
+		"digest as bytes": {
+			Metadata: &hashmachine.ProgramMetadata{
+				HashConfig:         hashInput.Metadata.HashConfig,
+				ExpectedInputCount: 1,
+				TypedStack:         true,
+			},
+			Ops: []*hashmachine.Op{
+				{Opcode: hashmachine.OpCode_OPCODE_PUSH_INPUT_HASHED, Index: 0},
+				{Opcode: hashmachine.OpCode_OPCODE_SLICE, Index: 0, Length: 1},
+			},
+		},
+		"digest as node data": {
+			Metadata: &hashmachine.ProgramMetadata{
+				HashConfig:         hashInput.Metadata.HashConfig,
+				ExpectedInputCount: 1,
+				BranchingFactor:    1,
+				TypedStack:         true,
+			},
+			Ops: []*hashmachine.Op{
+				{Opcode: hashmachine.OpCode_OPCODE_PUSH_INPUT_HASHED, Index: 0},
+				{Opcode: hashmachine.OpCode_OPCODE_PUSH_BYTES, Payload: a},
+				{Opcode: hashmachine.OpCode_OPCODE_POP_CHILDREN_AND_DATA_PUSH_HASH},
+			},
+		},
+	}
+	for name, p := range ill {
+		if err := hm.Validate(p); err == nil {
+			t.Errorf("%s: expected Validate error", name)
+		}
+		if _, err := hm.Verify(p, [][]byte{b}, o); err == nil {
+			t.Errorf("%s: expected Verify error", name)
+		}
+		// Without type tracking, the same program is accepted.
+		untyped := proto.Clone(p).(*hashmachine.Program)
+		untyped.Metadata.TypedStack = false
+		if _, err := hm.Verify(untyped, [][]byte{b}, o); err != nil {
+			t.Errorf("%s: untyped: %v", name, err)
+		}
+	}
+}
+
+func TestStrict(t *testing.T) {
+	strict := proto.Clone(hashInput2).(*hashmachine.Program)
+	strict.Metadata.Strict = true
+	ok, err := hm.Verify(strict, [][]byte{c, f}, g)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ok {
+		t.Error("strict: unequal output")
+	}
+	if _, err := hm.Verify(strict, [][]byte{a, b}, c); err == nil {
+		t.Error("strict: expected error for input that is not digest-sized")
+	}
+
+	// Inputs hashed as leaves can have any length.
+	ok, err = hm.Verify(hashedInput, [][]byte{b}, DecodeBase64OrDie("PiPoFgA5WUoziU9lZOGxNIu9egCI1CxKy3PurtWcAJ0"), hm.WithStrict())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ok {
+		t.Error("strict hashed input: unequal output")
+	}
+
+	literal := &hashmachine.Program{
+		Metadata: hashN.Metadata,
+		Ops:      []*hashmachine.Op{{Opcode: hashmachine.OpCode_OPCODE_PUSH_LITERAL, Index: 0}},
+		Literals: [][]byte{a},
+	}
+	for name, p := range map[string]*hashmachine.Program{"bytes": hashN, "literal": literal} {
+		if err := hm.Validate(p); err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+		if err := hm.Validate(p, hm.WithStrict()); err == nil {
+			t.Errorf("%s: expected Validate error in strict mode", name)
+		}
+		if _, err := hm.Verify(p, nil, nil, hm.WithStrict()); err == nil {
+			t.Errorf("%s: expected Verify error in strict mode", name)
+		}
+	}
+
+	// Byte string ops build values that need not be one digest long.
+	for name, p := range map[string]*hashmachine.Program{"concat": concat, "prepend": gitBlob} {
+		inputs := make([][]byte, p.Metadata.ExpectedInputCount)
+		for i := range inputs {
+			inputs[i] = c // digest-sized
+		}
+		if err := hm.Validate(p, hm.WithStrict()); err == nil || !strings.Contains(err.Error(), "not allowed") {
+			t.Errorf("%s: expected Validate error in strict mode, got %v", name, err)
+		}
+		if _, err := hm.Verify(p, inputs, nil, hm.WithStrict()); err == nil || !strings.Contains(err.Error(), "not allowed") {
+			t.Errorf("%s: expected Verify error in strict mode, got %v", name, err)
+		}
+	}
+
+	// Templates in strict mode may only push digest parameters.
+	if err := hm.ValidateTemplate(bInOTemplate, hm.WithStrict()); err == nil {
+		t.Error("expected ValidateTemplate error for bytes parameter in strict mode")
+	}
+	digests := proto.Clone(bInOTemplate).(*hashmachine.Template)
+	digests.Params[0] = hashmachine.ParamType_PARAMTYPE_DIGEST
+	if err := hm.ValidateTemplate(digests, hm.WithStrict()); err != nil {
+		t.Error(err)
+	}
+}
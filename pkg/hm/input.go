@@ -0,0 +1,75 @@
+package hm
+
+import (
+	"fmt"
+	"io"
+)
+
+// Input is a single input to a hashmachine program.
+//
+// An Input is either a byte string held in memory or a stream that is read
+// when the program uses the input. Streams are hashed incrementally by
+// OPCODE_PUSH_INPUT_HASHED, so verifying a large input does not require
+// holding it in memory. Other opcodes read the stream into memory.
+//
+// Each Input can be used at most once by a program. An Input holding a byte
+// string can be reused across HashMachines, but a stream is consumed when it
+// is read.
+type Input struct {
+	b []byte
+	r io.Reader
+}
+
+// BytesInput returns an Input holding b.
+func BytesInput(b []byte) *Input {
+	return &Input{b: b}
+}
+
+// ReaderInput returns an Input that reads from r when used.
+func ReaderInput(r io.Reader) *Input {
+	return &Input{r: r}
+}
+
+// ReaderAtInput returns an Input that reads size bytes from r, starting at
+// offset zero, when used.
+func ReaderAtInput(r io.ReaderAt, size int64) *Input {
+	return ReaderInput(io.NewSectionReader(r, 0, size))
+}
+
+// bytes returns the contents of the input, reading a stream into memory. If
+// max is positive, reading a stream longer than max bytes fails.
+func (in *Input) bytes(max int) ([]byte, error) {
+	if in.r == nil {
+		return in.b, nil
+	}
+	if max <= 0 {
+		return io.ReadAll(in.r)
+	}
+	b, err := io.ReadAll(io.LimitReader(in.r, int64(max)+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(b) > max {
+		return nil, fmt.Errorf("%w: value of more than %d bytes", ErrLimitExceeded, max)
+	}
+	return b, nil
+}
+
+// writeTo writes the contents of the input to w, streaming them if the input
+// is a stream.
+func (in *Input) writeTo(w io.Writer) error {
+	if in.r == nil {
+		_, err := w.Write(in.b)
+		return err
+	}
+	_, err := io.Copy(w, in.r)
+	return err
+}
+
+func bytesInputs(inputs [][]byte) []*Input {
+	r := make([]*Input, len(inputs))
+	for i, b := range inputs {
+		r[i] = BytesInput(b)
+	}
+	return r
+}
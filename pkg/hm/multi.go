@@ -0,0 +1,64 @@
+package hm
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"github.com/vsekhar/hashmachine"
+	"google.golang.org/protobuf/proto"
+)
+
+// VerifyMulti executes prog once for each of configs in lockstep, using each
+// config in place of the program's metadata.hash_config, and compares the
+// output of the i'th execution with expected[i]. Ops that select one of the
+// program's additional hash configs with Op.hash_config use that config in
+// every execution.
+//
+// VerifyMulti lets a program show that roots computed with different hash
+// functions (e.g. an old SHA-256 root and a new SHA3 root) cover the same
+// inputs. Programs with PUSH_BYTES payloads computed under one hash function,
+// such as sibling hashes, will generally only verify under that function.
+// Programs with an expected_output_count are not supported.
+func VerifyMulti(prog *hashmachine.Program, configs []*hashmachine.HashConfig, inputs [][]byte, expected [][]byte, opts ...Option) (ok bool, err error) {
+	if len(configs) == 0 {
+		return false, errors.New("no hash configs")
+	}
+	if len(expected) != len(configs) {
+		return false, fmt.Errorf("invalid output count: %d hash configs, got %d expected outputs", len(configs), len(expected))
+	}
+	if prog.Metadata == nil {
+		return false, errors.New("invalid program: no metadata")
+	}
+	if prog.Metadata.ExpectedOutputCount != 0 {
+		return false, fmt.Errorf("invalid invocation: program has %d outputs, VerifyMulti requires a single output", prog.Metadata.ExpectedOutputCount)
+	}
+	hms := make([]*HashMachine, len(configs))
+	for i, cfg := range configs {
+		md := proto.Clone(prog.Metadata).(*hashmachine.ProgramMetadata)
+		md.HashConfig = cfg
+		p := &hashmachine.Program{Metadata: md, Ops: prog.Ops, Literals: prog.Literals, Subroutines: prog.Subroutines}
+		if hms[i], err = New(p, inputs, opts...); err != nil {
+			return false, fmt.Errorf("hash config %d: %w", i, err)
+		}
+	}
+	for _, op := range prog.Ops {
+		for i, hm := range hms {
+			if err := hm.step(op); err != nil {
+				return false, fmt.Errorf("hash config %d: %w", i, err)
+			}
+		}
+	}
+	ok = true
+	for i, hm := range hms {
+		if err := hm.checkInputsUsed(); err != nil {
+			return false, fmt.Errorf("hash config %d: %w", i, err)
+		}
+		out, err := hm.Output()
+		if err != nil {
+			return false, fmt.Errorf("hash config %d: %w", i, err)
+		}
+		ok = ok && bytes.Equal(out, expected[i])
+	}
+	return ok, nil
+}
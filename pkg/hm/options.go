@@ -0,0 +1,121 @@
+package hm
+
+import (
+	"errors"
+
+	"github.com/vsekhar/hashmachine"
+)
+
+// Option configures a HashMachine, Decoder or hash.
+type Option func(*options)
+
+type options struct {
+	limits  Limits
+	hmacKey []byte
+	strict  bool
+	trace   TraceFunc
+}
+
+// ErrLimitExceeded is returned (wrapped) when executing or decoding a program
+// exceeds a resource limit.
+var ErrLimitExceeded = errors.New("resource limit exceeded")
+
+// Limits bounds the resources used to decode and execute a program. Unless
+// noted otherwise, a zero value for any field means no limit.
+type Limits struct {
+	// MaxOps is the maximum number of ops a program can execute, counting
+	// the ops of a subroutine each time it is called. If zero, DefaultMaxOps
+	// applies.
+	MaxOps int
+
+	// MaxStackDepth is the maximum number of values on the stack.
+	MaxStackDepth int
+
+	// MaxValueBytes is the maximum size of a value on the stack. If zero,
+	// DefaultMaxValueBytes applies.
+	MaxValueBytes int
+
+	// MaxHashes is the maximum number of hash sums computed while executing
+	// a program. Each hashing op counts as one hash sum, except
+	// OPCODE_REPEAT_HASH which counts as 'index' hash sums. If zero,
+	// DefaultMaxHashes applies.
+	MaxHashes int
+
+	// MaxMessageBytes is the maximum encoded size of a single message in a
+	// program stream. If zero, DefaultMaxMessageBytes applies.
+	MaxMessageBytes int
+}
+
+// DefaultMaxOps is the maximum number of ops a program can execute when
+// Limits.MaxOps is not set. It bounds the work done by programs whose
+// subroutine calls expand to many ops.
+const DefaultMaxOps = 1 << 24
+
+// DefaultMaxValueBytes is the maximum size of a value on the stack when
+// Limits.MaxValueBytes is not set. It bounds the memory used by programs that
+// repeatedly duplicate and concatenate values.
+const DefaultMaxValueBytes = 64 << 20
+
+// DefaultMaxHashes is the maximum number of hash sums a program can compute
+// when Limits.MaxHashes is not set. It bounds the work done by long
+// OPCODE_REPEAT_HASH chains.
+const DefaultMaxHashes = 1 << 24
+
+// DefaultMaxMessageBytes is the maximum encoded size of a single message in a
+// program stream when Limits.MaxMessageBytes is not set.
+const DefaultMaxMessageBytes = 64 << 20
+
+// WithLimits sets the resource limits enforced by a HashMachine.
+func WithLimits(l Limits) Option {
+	return func(o *options) { o.limits = l }
+}
+
+// WithHMACKey sets the key used by hash configs that use HMAC. The key is
+// supplied when a program is executed rather than embedded in the program.
+func WithHMACKey(key []byte) Option {
+	return func(o *options) { o.hmacKey = key }
+}
+
+// WithStrict enables strict mode, as though the program's metadata.strict
+// were set: every value pushed by OPCODE_PUSH_BYTES, OPCODE_PUSH_LITERAL or
+// OPCODE_PUSH_INPUT must be exactly one digest long, OPCODE_PUSH_PARAM may
+// only push digest parameters, and OPCODE_CONCAT, OPCODE_PREPEND,
+// OPCODE_APPEND and OPCODE_SLICE are not allowed.
+func WithStrict() Option {
+	return func(o *options) { o.strict = true }
+}
+
+// TraceFunc is called after a HashMachine executes an op, with the op and the
+// stack, top of stack last. It must not modify or retain the stack.
+type TraceFunc func(op *hashmachine.Op, stack [][]byte)
+
+// WithTrace sets a function called after each op a HashMachine executes,
+// including the ops of called subroutines and vendor opcodes. Ops that fail
+// are not traced.
+func WithTrace(trace TraceFunc) Option {
+	return func(o *options) { o.trace = trace }
+}
+
+// maxOps returns the maximum number of ops a program can execute.
+func (o *options) maxOps() int {
+	if o.limits.MaxOps > 0 {
+		return o.limits.MaxOps
+	}
+	return DefaultMaxOps
+}
+
+// maxValueBytes returns the maximum size of a value on the stack.
+func (o *options) maxValueBytes() int {
+	if o.limits.MaxValueBytes > 0 {
+		return o.limits.MaxValueBytes
+	}
+	return DefaultMaxValueBytes
+}
+
+// maxHashes returns the maximum number of hash sums a program can compute.
+func (o *options) maxHashes() int {
+	if o.limits.MaxHashes > 0 {
+		return o.limits.MaxHashes
+	}
+	return DefaultMaxHashes
+}
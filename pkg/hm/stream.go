@@ -0,0 +1,174 @@
+package hm
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/vsekhar/hashmachine"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+)
+
+// A program stream encodes a program as its ProgramMetadata, a Program message
+// holding only the program's literals and subroutines, and then each of the
+// program's Ops, each message prefixed by its length as a varint. Program
+// streams let a program be executed as it is decoded, without holding the
+// whole program in memory.
+
+// WriteStream writes p to w as a program stream.
+func WriteStream(w io.Writer, p *hashmachine.Program) error {
+	if err := writeMessage(w, p.Metadata); err != nil {
+		return err
+	}
+	if err := writeMessage(w, &hashmachine.Program{Literals: p.Literals, Subroutines: p.Subroutines}); err != nil {
+		return err
+	}
+	for _, op := range p.Ops {
+		if err := writeMessage(w, op); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeMessage(w io.Writer, m proto.Message) error {
+	b, err := proto.Marshal(m)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(protowire.AppendVarint(nil, uint64(len(b))), b...))
+	return err
+}
+
+// Decoder decodes a program stream.
+type Decoder struct {
+	r        *bufio.Reader
+	opts     options
+	metadata bool
+	header   *hashmachine.Program // literals and subroutines
+}
+
+// NewDecoder returns a Decoder reading a program stream from r. The
+// Decoder enforces Limits.MaxMessageBytes if set.
+func NewDecoder(r io.Reader, opts ...Option) *Decoder {
+	d := &Decoder{r: bufio.NewReader(r)}
+	for _, opt := range opts {
+		opt(&d.opts)
+	}
+	return d
+}
+
+// Metadata decodes the program's metadata, literals and subroutines. It must
+// be called once before calling Next.
+func (d *Decoder) Metadata() (*hashmachine.ProgramMetadata, error) {
+	if d.metadata {
+		return nil, errors.New("metadata already decoded")
+	}
+	md := new(hashmachine.ProgramMetadata)
+	if err := d.readMessage(md); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, fmt.Errorf("decoding metadata: %w", err)
+	}
+	header := new(hashmachine.Program)
+	if err := d.readMessage(header); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, fmt.Errorf("decoding literals and subroutines: %w", err)
+	}
+	d.metadata = true
+	d.header = header
+	return md, nil
+}
+
+// Literals returns the program's literals. It is valid after calling
+// Metadata.
+func (d *Decoder) Literals() [][]byte {
+	return d.header.GetLiterals()
+}
+
+// Subroutines returns the program's subroutines. It is valid after calling
+// Metadata.
+func (d *Decoder) Subroutines() []*hashmachine.Subroutine {
+	return d.header.GetSubroutines()
+}
+
+// Next decodes the next op in the stream. Next returns io.EOF when there are
+// no more ops.
+func (d *Decoder) Next() (*hashmachine.Op, error) {
+	if !d.metadata {
+		return nil, errors.New("metadata not yet decoded")
+	}
+	op := new(hashmachine.Op)
+	if err := d.readMessage(op); err != nil {
+		return nil, err
+	}
+	return op, nil
+}
+
+// readMessage reads a length-delimited message into m. It returns io.EOF only
+// if the stream ends cleanly before the message.
+func (d *Decoder) readMessage(m proto.Message) error {
+	n, err := binary.ReadUvarint(d.r)
+	if err != nil {
+		return err
+	}
+	max := d.opts.limits.MaxMessageBytes
+	if max <= 0 {
+		max = DefaultMaxMessageBytes
+	}
+	if n > uint64(max) {
+		return fmt.Errorf("%w: message of %d bytes exceeds %d", ErrLimitExceeded, n, max)
+	}
+	// Grow the buffer as data arrives rather than trusting the length prefix.
+	var b bytes.Buffer
+	if _, err := io.CopyN(&b, d.r, int64(n)); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return err
+	}
+	return proto.Unmarshal(b.Bytes(), m)
+}
+
+// VerifyStream decodes a program stream from r and executes each op as it is
+// decoded. It returns the same result as Verify would for the decoded program,
+// failing as soon as an op fails or a limit is exceeded.
+func VerifyStream(r io.Reader, inputs []*Input, expected []byte, opts ...Option) (ok bool, err error) {
+	d := NewDecoder(r, opts...)
+	md, err := d.Metadata()
+	if err != nil {
+		return false, err
+	}
+	p := &hashmachine.Program{Metadata: md, Literals: d.Literals(), Subroutines: d.Subroutines()}
+	hm, err := NewWithInputs(p, inputs, opts...)
+	if err != nil {
+		return false, err
+	}
+	for {
+		op, err := d.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return false, fmt.Errorf("decoding op %d: %w", hm.ip, err)
+		}
+		if err := hm.step(op); err != nil {
+			return false, err
+		}
+	}
+	if err := hm.checkInputsUsed(); err != nil {
+		return false, err
+	}
+	out, err := hm.Output()
+	if err != nil {
+		return false, err
+	}
+	return bytes.Equal(out, expected), nil
+}
@@ -0,0 +1,51 @@
+package hm
+
+import (
+	"fmt"
+
+	"github.com/vsekhar/hashmachine"
+)
+
+// checkSubroutines checks that each subroutine of p only calls subroutines
+// with lower indexes.
+func checkSubroutines(p *hashmachine.Program) error {
+	for i, sub := range p.Subroutines {
+		for j, op := range sub.Ops {
+			if op.Opcode == hashmachine.OpCode_OPCODE_CALL && op.Index >= uint64(i) {
+				return fmt.Errorf("invalid program: subroutine %d op %d calls subroutine %d, subroutines may only call lower subroutines", i, j, op.Index)
+			}
+		}
+	}
+	return nil
+}
+
+// checkExpandedLen returns an error if p, or any of its subroutines, has more
+// than max ops with every OPCODE_CALL replaced by the ops of the called
+// subroutine. p's subroutines must have been checked with checkSubroutines.
+func checkExpandedLen(p *hashmachine.Program, max int) error {
+	lens := make([]int, len(p.Subroutines))
+	// count returns the expanded length of ops, or -1 if it exceeds max.
+	count := func(ops []*hashmachine.Op) int {
+		n := 0
+		for _, op := range ops {
+			m := 1
+			if op.Opcode == hashmachine.OpCode_OPCODE_CALL && op.Index < uint64(len(lens)) {
+				m = lens[op.Index]
+			}
+			if m > max-n {
+				return -1
+			}
+			n += m
+		}
+		return n
+	}
+	for i, sub := range p.Subroutines {
+		if lens[i] = count(sub.Ops); lens[i] < 0 {
+			return fmt.Errorf("%w: subroutine %d expands to more than %d ops", ErrLimitExceeded, i, max)
+		}
+	}
+	if count(p.Ops) < 0 {
+		return fmt.Errorf("%w: program expands to more than %d ops", ErrLimitExceeded, max)
+	}
+	return nil
+}
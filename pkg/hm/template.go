@@ -0,0 +1,70 @@
+package hm
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/vsekhar/hashmachine"
+	"google.golang.org/protobuf/proto"
+)
+
+// Instantiate returns the program produced by replacing each
+// OPCODE_PUSH_PARAM in t, including those in subroutines, with an
+// OPCODE_PUSH_BYTES of the corresponding parameter in params. Instantiate
+// returns an error if params does not match the number and types of t's
+// parameters.
+func Instantiate(t *hashmachine.Template, params [][]byte) (*hashmachine.Program, error) {
+	if t.Program == nil {
+		return nil, errors.New("invalid template: no program")
+	}
+	if len(params) != len(t.Params) {
+		return nil, fmt.Errorf("template has %d parameters, got %d", len(t.Params), len(params))
+	}
+	if t.Program.Metadata == nil {
+		return nil, errors.New("invalid template: no metadata")
+	}
+	for i, pt := range t.Params {
+		switch pt {
+		case hashmachine.ParamType_PARAMTYPE_BYTES, hashmachine.ParamType_PARAMTYPE_DIGEST:
+		default:
+			return nil, fmt.Errorf("invalid template: parameter %d has bad type %s", i, pt)
+		}
+	}
+
+	p := proto.Clone(t.Program).(*hashmachine.Program)
+	md := p.Metadata
+	instantiate := func(ops []*hashmachine.Op) error {
+		for j, op := range ops {
+			if op.Opcode != hashmachine.OpCode_OPCODE_PUSH_PARAM {
+				continue
+			}
+			if op.Index >= uint64(len(params)) {
+				return fmt.Errorf("invalid template: parameter index out of bounds %d, template has %d parameters", op.Index, len(params))
+			}
+			if int(op.HashConfig) > len(md.HashConfigs) {
+				return fmt.Errorf("invalid template: hash config index out of bounds %d, program has %d additional hash configs", op.HashConfig, len(md.HashConfigs))
+			}
+			if t.Params[op.Index] == hashmachine.ParamType_PARAMTYPE_DIGEST {
+				// Digests are sized by the hash config the op selects.
+				h, err := newHash(hashConfig(md, op), nil)
+				if err != nil {
+					return err
+				}
+				if n := len(params[op.Index]); n != h.Size() {
+					return fmt.Errorf("parameter %d: expected %d byte digest, got %d bytes", op.Index, h.Size(), n)
+				}
+			}
+			ops[j] = &hashmachine.Op{Opcode: hashmachine.OpCode_OPCODE_PUSH_BYTES, Payload: params[op.Index], HashConfig: op.HashConfig}
+		}
+		return nil
+	}
+	if err := instantiate(p.Ops); err != nil {
+		return nil, err
+	}
+	for i, sub := range p.Subroutines {
+		if err := instantiate(sub.Ops); err != nil {
+			return nil, fmt.Errorf("subroutine %d: %w", i, err)
+		}
+	}
+	return p, nil
+}
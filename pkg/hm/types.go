@@ -0,0 +1,135 @@
+package hm
+
+import (
+	"fmt"
+
+	"github.com/vsekhar/hashmachine"
+)
+
+// valueType is the type of a value on the stack of a program with
+// metadata.typed_stack set.
+type valueType int
+
+const (
+	typeInput   valueType = iota + 1 // raw input, or data derived from one
+	typeLiteral                      // bytes embedded in the program
+	typeLeaf                         // hash of raw data
+	typeNode                         // hash of digests
+)
+
+func (t valueType) String() string {
+	switch t {
+	case typeInput:
+		return "input"
+	case typeLiteral:
+		return "literal"
+	case typeLeaf:
+		return "leaf digest"
+	case typeNode:
+		return "node digest"
+	default:
+		return fmt.Sprintf("valueType(%d)", int(t))
+	}
+}
+
+func (t valueType) raw() bool    { return t == typeInput || t == typeLiteral }
+func (t valueType) digest() bool { return t != typeInput }
+
+// typeOp returns the types of the values on the stack after op, which has
+// effect e, is applied to a stack holding values of types ts (bottom first).
+// It returns an error if op does not accept the types of its operands. ts must
+// hold at least e.needs values; typeOp may modify it.
+//
+// Literals are accepted both as data and as digests, since programs push
+// sibling hashes as literals. Values derived from inputs cannot be hashed as
+// tree nodes without first being hashed as leaves, and digests cannot be
+// hashed as leaves or manipulated as bytes.
+func typeOp(op *hashmachine.Op, e effect, ts []valueType) ([]valueType, error) {
+	n := len(ts)
+	operands := make([]valueType, e.needs) // in pop order
+	for i := range operands {
+		operands[i] = ts[n-1-i]
+	}
+	var push valueType
+	switch op.Opcode {
+	case hashmachine.OpCode_OPCODE_DUP:
+		return append(ts, ts[n-1-int(op.Index)]), nil
+	case hashmachine.OpCode_OPCODE_SWAP:
+		ts[n-1], ts[n-1-int(op.Index)] = ts[n-1-int(op.Index)], ts[n-1]
+		return ts, nil
+	case hashmachine.OpCode_OPCODE_ROT:
+		ts[n-3], ts[n-2], ts[n-1] = ts[n-2], ts[n-1], ts[n-3]
+		return ts, nil
+	case hashmachine.OpCode_OPCODE_MATCH_INPUT,
+		hashmachine.OpCode_OPCODE_MATCH_OUTPUT,
+		hashmachine.OpCode_OPCODE_MATCH_BYTES,
+		hashmachine.OpCode_OPCODE_DROP:
+		return ts[:n-e.pops], nil
+	case hashmachine.OpCode_OPCODE_PUSH_INPUT:
+		push = typeInput
+	case hashmachine.OpCode_OPCODE_PUSH_BYTES,
+		hashmachine.OpCode_OPCODE_PUSH_LITERAL,
+		hashmachine.OpCode_OPCODE_PUSH_PARAM:
+		push = typeLiteral
+	case hashmachine.OpCode_OPCODE_PUSH_INPUT_HASHED:
+		push = typeLeaf
+	case hashmachine.OpCode_OPCODE_POP_CHILDREN_PUSH_HASH,
+		hashmachine.OpCode_OPCODE_POP_SORTED_CHILDREN_PUSH_HASH,
+		hashmachine.OpCode_OPCODE_POP_CHILDREN_AND_DATA_PUSH_HASH:
+		children := operands
+		if op.Opcode == hashmachine.OpCode_OPCODE_POP_CHILDREN_AND_DATA_PUSH_HASH {
+			children = operands[:len(operands)-1]
+			if data := operands[len(operands)-1]; !data.raw() {
+				return nil, fmt.Errorf("invalid program: %s cannot take %s as node data", op.Opcode, data)
+			}
+		}
+		for _, t := range children {
+			if !t.digest() {
+				return nil, fmt.Errorf("invalid program: %s cannot take %s as a child, hash it as a leaf first", op.Opcode, t)
+			}
+		}
+		push = typeNode
+	case hashmachine.OpCode_OPCODE_POP_N_PUSH_HASH,
+		hashmachine.OpCode_OPCODE_PEAK_N_PUSH_HASH,
+		hashmachine.OpCode_OPCODE_REPEAT_HASH:
+		// Hashing raw data yields a leaf and hashing digests yields a node,
+		// but the two cannot be mixed.
+		if push = hashType(operands); push == 0 {
+			return nil, fmt.Errorf("invalid program: %s cannot hash inputs together with digests", op.Opcode)
+		}
+	case hashmachine.OpCode_OPCODE_CONCAT,
+		hashmachine.OpCode_OPCODE_PREPEND,
+		hashmachine.OpCode_OPCODE_APPEND,
+		hashmachine.OpCode_OPCODE_SLICE:
+		push = typeLiteral
+		for _, t := range operands {
+			if !t.raw() {
+				return nil, fmt.Errorf("invalid program: %s cannot take %s", op.Opcode, t)
+			}
+			if t == typeInput {
+				push = typeInput
+			}
+		}
+	default:
+		return nil, fmt.Errorf("invalid program: %s cannot be used with a typed stack", op.Opcode)
+	}
+	return append(ts[:n-e.pops], push), nil
+}
+
+// hashType returns the type of the hash of values of types ts, or zero if
+// they cannot be hashed together.
+func hashType(ts []valueType) valueType {
+	input, digest := false, false
+	for _, t := range ts {
+		input = input || t == typeInput
+		digest = digest || (t == typeLeaf || t == typeNode)
+	}
+	switch {
+	case input && digest:
+		return 0
+	case input:
+		return typeLeaf
+	default:
+		return typeNode
+	}
+}
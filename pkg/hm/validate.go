@@ -0,0 +1,448 @@
+package hm
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/vsekhar/hashmachine"
+)
+
+// effect describes how an op changes the stack. The op requires at least
+// needs values on the stack, pops pops values and then pushes pushes values.
+// Hashes is the number of hash sums the op computes.
+type effect struct {
+	needs, pops, pushes int
+	hashes              int
+}
+
+// maxCount bounds the number of stack values an op can refer to, so that
+// counts taken from Op.index cannot overflow an int.
+const maxCount = 1 << 31
+
+func count(op *hashmachine.Op) (int, error) {
+	if op.Index >= maxCount {
+		return 0, fmt.Errorf("invalid program: index %d too large for %s", op.Index, op.Opcode)
+	}
+	return int(op.Index), nil
+}
+
+// stackEffect returns the effect of op on the stack, or an error if op is
+// not valid under md regardless of the state of the stack.
+func stackEffect(md *hashmachine.ProgramMetadata, op *hashmachine.Op) (effect, error) {
+	if int(op.HashConfig) > len(md.HashConfigs) {
+		return effect{}, fmt.Errorf("invalid program: hash config index out of bounds %d, program has %d additional hash configs", op.HashConfig, len(md.HashConfigs))
+	}
+	switch op.Opcode {
+	case hashmachine.OpCode_OPCODE_UNKNOWN:
+		return effect{}, errors.New("invalid program: opcode is UNKNOWN")
+	case hashmachine.OpCode_OPCODE_PUSH_INPUT,
+		hashmachine.OpCode_OPCODE_PUSH_BYTES,
+		hashmachine.OpCode_OPCODE_PUSH_LITERAL,
+		hashmachine.OpCode_OPCODE_PUSH_PARAM:
+		return effect{0, 0, 1, 0}, nil
+	case hashmachine.OpCode_OPCODE_PUSH_INPUT_HASHED:
+		return effect{0, 0, 1, 1}, nil
+	case hashmachine.OpCode_OPCODE_POP_CHILDREN_PUSH_HASH,
+		hashmachine.OpCode_OPCODE_POP_CHILDREN_AND_DATA_PUSH_HASH,
+		hashmachine.OpCode_OPCODE_POP_SORTED_CHILDREN_PUSH_HASH:
+		if md.BranchingFactor < 1 {
+			return effect{}, fmt.Errorf("bad branching factor in metadata: %d", md.BranchingFactor)
+		}
+		n := int(md.BranchingFactor)
+		if op.Opcode == hashmachine.OpCode_OPCODE_POP_CHILDREN_AND_DATA_PUSH_HASH {
+			n++
+		}
+		return effect{n, n, 1, 1}, nil
+	case hashmachine.OpCode_OPCODE_POP_N_PUSH_HASH:
+		n, err := count(op)
+		return effect{n, n, 1, 1}, err
+	case hashmachine.OpCode_OPCODE_CONCAT:
+		n, err := count(op)
+		return effect{n, n, 1, 0}, err
+	case hashmachine.OpCode_OPCODE_PEAK_N_PUSH_HASH:
+		n, err := count(op)
+		return effect{n, 0, 1, 1}, err
+	case hashmachine.OpCode_OPCODE_REPEAT_HASH:
+		n, err := count(op)
+		if err == nil && n < 1 {
+			err = errors.New("invalid program: REPEAT_HASH index must be at least 1")
+		}
+		return effect{1, 1, 1, n}, err
+	case hashmachine.OpCode_OPCODE_MATCH_INPUT,
+		hashmachine.OpCode_OPCODE_MATCH_OUTPUT,
+		hashmachine.OpCode_OPCODE_MATCH_BYTES,
+		hashmachine.OpCode_OPCODE_DROP:
+		return effect{1, 1, 0, 0}, nil
+	case hashmachine.OpCode_OPCODE_PREPEND,
+		hashmachine.OpCode_OPCODE_APPEND,
+		hashmachine.OpCode_OPCODE_SLICE:
+		return effect{1, 1, 1, 0}, nil
+	case hashmachine.OpCode_OPCODE_DUP:
+		n, err := count(op)
+		return effect{n + 1, 0, 1, 0}, err
+	case hashmachine.OpCode_OPCODE_SWAP:
+		n, err := count(op)
+		if err == nil && n < 1 {
+			err = errors.New("invalid program: SWAP index must be at least 1")
+		}
+		return effect{n + 1, 0, 0, 0}, err
+	case hashmachine.OpCode_OPCODE_ROT:
+		return effect{3, 0, 0, 0}, nil
+	default:
+		if isVendorOp(op.Opcode) {
+			spec, ok := lookupOp(op.Opcode)
+			if !ok {
+				return effect{}, fmt.Errorf("invalid program: unregistered vendor opcode %d", op.Opcode)
+			}
+			return effect{spec.Pops, spec.Pops, spec.Pushes, spec.Hashes}, nil
+		}
+		return effect{}, fmt.Errorf("invalid program: unknown opcode %d", op.Opcode)
+	}
+}
+
+// Validate statically checks p without executing it. Validate checks the
+// program's hash configurations, that every op is known, that no op underflows
+// the stack, that each input is used and each output is matched exactly once
+// and that the program leaves the expected number of values on the stack.
+// Subroutine calls are checked as though the subroutine's ops appeared in
+// place of the call, but each subroutine is only checked once. Validate checks
+// the types of values on the stack if the program has a typed stack, and the
+// lengths of pushed values in strict mode. Validate enforces Limits.MaxOps, or
+// DefaultMaxOps if it is not set, and rejects single ops that compute more
+// than Limits.MaxHashes hash sums, or DefaultMaxHashes if it is not set. HMAC
+// keys are not needed to validate a program.
+//
+// A program that passes Validate can still fail verification, for example if
+// a value does not match an input, output or anchor.
+func Validate(p *hashmachine.Program, opts ...Option) error {
+	return validate(p, nil, opts...)
+}
+
+// ValidateTemplate statically checks t as Validate does, additionally checking
+// that each parameter has a known type and that each OPCODE_PUSH_PARAM refers
+// to a parameter of t. Instantiating a template that passes ValidateTemplate
+// yields a program that passes Validate.
+func ValidateTemplate(t *hashmachine.Template, opts ...Option) error {
+	if t.Program == nil {
+		return errors.New("invalid template: no program")
+	}
+	for i, pt := range t.Params {
+		if pt != hashmachine.ParamType_PARAMTYPE_BYTES && pt != hashmachine.ParamType_PARAMTYPE_DIGEST {
+			return fmt.Errorf("invalid template: parameter %d has bad type %s", i, pt)
+		}
+	}
+	return validate(t.Program, t.Params, opts...)
+}
+
+// validate checks p, whose OPCODE_PUSH_PARAM ops may refer to params.
+func validate(p *hashmachine.Program, params []hashmachine.ParamType, opts ...Option) error {
+	md := p.Metadata
+	if md == nil {
+		return errors.New("invalid program: no metadata")
+	}
+	var sizes []int // output sizes, indexed by Op.hash_config
+	for i, cfg := range append([]*hashmachine.HashConfig{md.HashConfig}, md.HashConfigs...) {
+		// The HMAC key is not needed to check a program.
+		h, err := newHash(cfg, nil)
+		if err != nil {
+			if i > 0 {
+				err = fmt.Errorf("hash config %d: %w", i, err)
+			}
+			return err
+		}
+		sizes = append(sizes, h.Size())
+	}
+	if err := checkSubroutines(p); err != nil {
+		return err
+	}
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if err := checkExpandedLen(p, o.maxOps()); err != nil {
+		return err
+	}
+	v := &validator{
+		p:      p,
+		params: params,
+		strict: md.Strict || o.strict,
+		sizes:  sizes,
+		hashes: o.maxHashes(),
+		subs:   make([]*frame, len(p.Subroutines)),
+		errs:   make([]error, len(p.Subroutines)),
+		types:  make(map[string][]valueType),
+	}
+	f := v.newFrame()
+	if err := v.run(p.Ops, f, true); err != nil {
+		return err
+	}
+	if md.TypedStack {
+		if _, err := v.typeOps(p.Ops, nil); err != nil {
+			return err
+		}
+	}
+	if i, ok := f.inputs.unused(); ok {
+		return fmt.Errorf("invalid program: input %d not used", i)
+	}
+	if i, ok := f.outputs.unused(); ok {
+		return fmt.Errorf("invalid program: output %d not matched", i)
+	}
+	want := 1
+	if f.outputs.count > 0 {
+		want = 0
+	}
+	if f.depth != want {
+		return fmt.Errorf("invalid program: expected %d values on stack after completing, found %d", want, f.depth)
+	}
+	return nil
+}
+
+// validator holds the state of a program being validated.
+type validator struct {
+	p      *hashmachine.Program
+	params []hashmachine.ParamType
+	strict bool
+	sizes  []int
+	hashes int // maximum hash sums computed by a single op
+
+	// The effects of subroutines and the errors found in them, indexed by
+	// subroutine, so that each subroutine is checked once however often it
+	// is called.
+	subs []*frame
+	errs []error
+
+	// The types of the values left by a subroutine, keyed by the subroutine
+	// and the types of the values it consumes, if the program has a typed
+	// stack.
+	types map[string][]valueType
+}
+
+// frame is the effect of a sequence of ops: the top level of a program or the
+// body of a subroutine.
+type frame struct {
+	depth   int // change in stack depth, or the depth at the top level
+	needs   int // values a subroutine needs on the stack when called
+	inputs  *uses
+	outputs *uses
+}
+
+func (v *validator) newFrame() *frame {
+	md := v.p.Metadata
+	return &frame{
+		inputs:  &uses{what: "input", count: uint64(md.ExpectedInputCount), used: make(map[uint64]bool)},
+		outputs: &uses{what: "output", count: uint64(md.ExpectedOutputCount), used: make(map[uint64]bool)},
+	}
+}
+
+// uses records the inputs or outputs used by a sequence of ops, in order of
+// use.
+type uses struct {
+	what  string
+	count uint64
+	used  map[uint64]bool
+	order []uint64
+}
+
+// use marks index used, returning an error if index is out of bounds or
+// already used.
+func (u *uses) use(index uint64) error {
+	if index >= u.count {
+		return fmt.Errorf("invalid program: %s index out of bounds %d, program's expected %s count %d", u.what, index, u.what, u.count)
+	}
+	if u.used[index] {
+		return fmt.Errorf("invalid program: %s %d used more than once", u.what, index)
+	}
+	u.used[index] = true
+	u.order = append(u.order, index)
+	return nil
+}
+
+// unused returns the lowest index that is not used, if any.
+func (u *uses) unused() (uint64, bool) {
+	if uint64(len(u.order)) == u.count {
+		return 0, false
+	}
+	i := uint64(0)
+	for u.used[i] {
+		i++
+	}
+	return i, true
+}
+
+// run checks ops and applies their effect to f. At the top level, the stack
+// must hold enough values for each op; in subroutines, f.needs records how
+// many values the caller must provide.
+func (v *validator) run(ops []*hashmachine.Op, f *frame, top bool) error {
+	for j, op := range ops {
+		if err := v.step(op, f, top); err != nil {
+			return fmt.Errorf("op %d: %w", j, err)
+		}
+	}
+	return nil
+}
+
+func (v *validator) step(op *hashmachine.Op, f *frame, top bool) error {
+	var needs, delta int
+	if op.Opcode == hashmachine.OpCode_OPCODE_CALL {
+		s, err := v.sub(op.Index)
+		if err != nil {
+			return err
+		}
+		for _, i := range s.inputs.order {
+			if err := f.inputs.use(i); err != nil {
+				return err
+			}
+		}
+		for _, i := range s.outputs.order {
+			if err := f.outputs.use(i); err != nil {
+				return err
+			}
+		}
+		needs, delta = s.needs, s.depth
+	} else {
+		e, err := v.checkOp(op, f)
+		if err != nil {
+			return err
+		}
+		needs, delta = e.needs, e.pushes-e.pops
+	}
+	switch {
+	case top && f.depth < needs:
+		return fmt.Errorf("invalid program: stack underflow, expected at least %d values, found %d", needs, f.depth)
+	case !top && needs-f.depth > f.needs:
+		f.needs = needs - f.depth
+	}
+	f.depth += delta
+	return nil
+}
+
+// sub returns the effect of subroutine i, checking it the first time it is
+// called.
+func (v *validator) sub(i uint64) (*frame, error) {
+	if i >= uint64(len(v.p.Subroutines)) {
+		return nil, fmt.Errorf("invalid program: subroutine index out of bounds %d, program has %d subroutines", i, len(v.p.Subroutines))
+	}
+	if v.subs[i] == nil {
+		// Subroutines only call lower subroutines, so this terminates.
+		f := v.newFrame()
+		if err := v.run(v.p.Subroutines[i].Ops, f, false); err != nil {
+			v.errs[i] = fmt.Errorf("subroutine %d: %w", i, err)
+		}
+		v.subs[i] = f
+	}
+	return v.subs[i], v.errs[i]
+}
+
+// checkOp checks the parts of op that do not depend on the stack and records
+// the inputs and outputs it uses in f.
+func (v *validator) checkOp(op *hashmachine.Op, f *frame) (effect, error) {
+	e, err := stackEffect(v.p.Metadata, op)
+	if err != nil {
+		return effect{}, err
+	}
+	if e.hashes > v.hashes {
+		return effect{}, fmt.Errorf("%w: %s computes %d hash sums, more than %d", ErrLimitExceeded, op.Opcode, e.hashes, v.hashes)
+	}
+	if v.strict {
+		if err := checkStrictOp(op); err != nil {
+			return effect{}, err
+		}
+	}
+	switch op.Opcode {
+	case hashmachine.OpCode_OPCODE_PUSH_INPUT,
+		hashmachine.OpCode_OPCODE_PUSH_INPUT_HASHED,
+		hashmachine.OpCode_OPCODE_MATCH_INPUT:
+		if err := f.inputs.use(op.Index); err != nil {
+			return effect{}, err
+		}
+	case hashmachine.OpCode_OPCODE_MATCH_OUTPUT:
+		if err := f.outputs.use(op.Index); err != nil {
+			return effect{}, err
+		}
+	case hashmachine.OpCode_OPCODE_PUSH_LITERAL:
+		if op.Index >= uint64(len(v.p.Literals)) {
+			return effect{}, fmt.Errorf("invalid program: literal index out of bounds %d, program has %d literals", op.Index, len(v.p.Literals))
+		}
+		if v.strict {
+			if err := checkStrict(op, v.sizes[op.HashConfig], len(v.p.Literals[op.Index])); err != nil {
+				return effect{}, err
+			}
+		}
+	case hashmachine.OpCode_OPCODE_PUSH_BYTES:
+		if v.strict {
+			if err := checkStrict(op, v.sizes[op.HashConfig], len(op.Payload)); err != nil {
+				return effect{}, err
+			}
+		}
+	case hashmachine.OpCode_OPCODE_PUSH_PARAM:
+		if op.Index >= uint64(len(v.params)) {
+			return effect{}, fmt.Errorf("invalid program: parameter index out of bounds %d, program has %d parameters", op.Index, len(v.params))
+		}
+		// Digest parameters are checked against the op's hash config by
+		// Instantiate; parameters of other types can have any length.
+		if v.strict && v.params[op.Index] != hashmachine.ParamType_PARAMTYPE_DIGEST {
+			return effect{}, fmt.Errorf("invalid program: strict mode: %s pushes parameter %d of type %s, expected %s", op.Opcode, op.Index, v.params[op.Index], hashmachine.ParamType_PARAMTYPE_DIGEST)
+		}
+	}
+	return e, nil
+}
+
+// typeOps returns the types of the values on the stack after ops are applied
+// to a stack holding values of types ts (bottom first). ops must have been
+// checked with run.
+func (v *validator) typeOps(ops []*hashmachine.Op, ts []valueType) ([]valueType, error) {
+	for j, op := range ops {
+		var err error
+		if op.Opcode == hashmachine.OpCode_OPCODE_CALL {
+			n := len(ts) - v.subs[op.Index].needs
+			var out []valueType
+			if out, err = v.typeSub(op.Index, ts[n:]); err == nil {
+				ts = append(ts[:n], out...)
+			}
+		} else {
+			e, _ := stackEffect(v.p.Metadata, op) // checked by run
+			ts, err = typeOp(op, e, ts)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("op %d: %w", j, err)
+		}
+	}
+	return ts, nil
+}
+
+// typeSub returns the types of the values subroutine i leaves in place of the
+// values of types args that it consumes.
+func (v *validator) typeSub(i uint64, args []valueType) ([]valueType, error) {
+	key := fmt.Sprint(i, args)
+	if out, ok := v.types[key]; ok {
+		return out, nil
+	}
+	out, err := v.typeOps(v.p.Subroutines[i].Ops, append([]valueType(nil), args...))
+	if err != nil {
+		return nil, fmt.Errorf("subroutine %d: %w", i, err)
+	}
+	v.types[key] = out
+	return out, nil
+}
+
+// checkStrictOp returns an error if op builds values from bytes, which strict
+// mode forbids since the values need not be one digest long.
+func checkStrictOp(op *hashmachine.Op) error {
+	switch op.Opcode {
+	case hashmachine.OpCode_OPCODE_CONCAT,
+		hashmachine.OpCode_OPCODE_PREPEND,
+		hashmachine.OpCode_OPCODE_APPEND,
+		hashmachine.OpCode_OPCODE_SLICE:
+		return fmt.Errorf("invalid program: strict mode: %s is not allowed", op.Opcode)
+	}
+	return nil
+}
+
+// checkStrict returns an error if op pushes a value of n bytes that is not
+// exactly size bytes long.
+func checkStrict(op *hashmachine.Op, size, n int) error {
+	if n != size {
+		return fmt.Errorf("invalid program: strict mode: %s pushes %d bytes, expected digest of %d bytes", op.Opcode, n, size)
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+package hm
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/vsekhar/hashmachine"
+	"github.com/vsekhar/hashmachine/pkg/oncehash"
+)
+
+// Vendor opcodes are opcodes in the range [MinVendorOpCode, MaxVendorOpCode],
+// which is reserved in the OpCode enum. Applications can prototype
+// domain-specific ops by registering handlers for vendor opcodes with
+// RegisterOp.
+const (
+	MinVendorOpCode hashmachine.OpCode = 1000
+	MaxVendorOpCode hashmachine.OpCode = 1999
+)
+
+// OpFunc implements a vendor opcode. It is called with the op being executed,
+// the hash function selected by the op and the values popped from the stack,
+// top of stack first. It returns the values to push, in push order.
+//
+// h must be reset before each use.
+type OpFunc func(op *hashmachine.Op, h oncehash.Hash, args [][]byte) ([][]byte, error)
+
+// OpSpec declares the stack effect and implementation of a vendor opcode.
+type OpSpec struct {
+	// Pops is the number of values the op pops from the stack.
+	Pops int
+
+	// Pushes is the number of values the op pushes onto the stack. Func must
+	// return exactly this many values.
+	Pushes int
+
+	// Hashes is the number of hash sums the op computes, counted against
+	// Limits.MaxHashes.
+	Hashes int
+
+	// Func implements the op.
+	Func OpFunc
+}
+
+var (
+	vendorOpsMu sync.RWMutex
+	vendorOps   = make(map[hashmachine.OpCode]OpSpec)
+)
+
+func isVendorOp(code hashmachine.OpCode) bool {
+	return code >= MinVendorOpCode && code <= MaxVendorOpCode
+}
+
+// RegisterOp registers spec as the implementation of the vendor opcode code.
+// Registered opcodes are checked by Validate, count towards Limits and are
+// traced by WithTrace like built-in opcodes. RegisterOp is intended to be called from init functions;
+// it panics if code is outside the vendor range, is already registered or if
+// spec is malformed.
+func RegisterOp(code hashmachine.OpCode, spec OpSpec) {
+	if !isVendorOp(code) {
+		panic(fmt.Sprintf("hm: RegisterOp: opcode %d outside vendor range [%d, %d]", code, MinVendorOpCode, MaxVendorOpCode))
+	}
+	if spec.Func == nil || spec.Pops < 0 || spec.Pushes < 0 || spec.Hashes < 0 {
+		panic(fmt.Sprintf("hm: RegisterOp: malformed spec for opcode %d", code))
+	}
+	vendorOpsMu.Lock()
+	defer vendorOpsMu.Unlock()
+	if _, dup := vendorOps[code]; dup {
+		panic(fmt.Sprintf("hm: RegisterOp: opcode %d registered twice", code))
+	}
+	vendorOps[code] = spec
+}
+
+func lookupOp(code hashmachine.OpCode) (OpSpec, bool) {
+	if !isVendorOp(code) {
+		return OpSpec{}, false
+	}
+	vendorOpsMu.RLock()
+	defer vendorOpsMu.RUnlock()
+	spec, ok := vendorOps[code]
+	return spec, ok
+}
+
+// applyVendor applies a registered vendor op with effect e to the stack.
+func (hm *HashMachine) applyVendor(op *hashmachine.Op, spec OpSpec, e effect, h oncehash.Hash) error {
+	args := make([][]byte, e.pops)
+	for i := range args {
+		args[i] = hm.pop()
+	}
+	vals, err := spec.Func(op, h, args)
+	if err != nil {
+		return fmt.Errorf("vendor opcode %d: %w", op.Opcode, err)
+	}
+	if len(vals) != e.pushes {
+		return fmt.Errorf("vendor opcode %d: pushed %d values, declared %d", op.Opcode, len(vals), e.pushes)
+	}
+	for _, v := range vals {
+		if err := hm.checkValueSize(len(v)); err != nil {
+			return err
+		}
+		hm.push(v)
+	}
+	return nil
+}
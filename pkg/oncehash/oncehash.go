@@ -91,3 +91,25 @@ func (h *hashOnceWrapper) BlockSize() int { return h.h.BlockSize() }
 func WrapHash(h hash.Hash) Hash {
 	return &hashOnceWrapper{h: h}
 }
+
+// truncateWrapper truncates the output of a Hash.
+type truncateWrapper struct {
+	Hash
+	n int
+}
+
+func (t *truncateWrapper) Sum(b []byte) []byte {
+	b = t.Hash.Sum(b)
+	return b[:len(b)-t.Hash.Size()+t.n]
+}
+
+func (t *truncateWrapper) Size() int { return t.n }
+
+// Truncate returns a Hash whose Sum appends only the first n bytes of the
+// output of h. Truncate panics unless 0 < n <= h.Size().
+func Truncate(h Hash, n int) Hash {
+	if n <= 0 || n > h.Size() {
+		panic("oncehash: truncated length out of range")
+	}
+	return &truncateWrapper{Hash: h, n: n}
+}
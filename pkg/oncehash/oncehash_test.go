@@ -60,3 +60,25 @@ func TestSize(t *testing.T) {
 		hs["shakehash"].BlockSize()
 	})
 }
+
+func TestTruncate(t *testing.T) {
+	for n, h := range makeHashers() {
+		full := h.Sum(nil)
+		h.Reset()
+		th := oncehash.Truncate(h, 16)
+		if th.Size() != 16 {
+			t.Errorf("%s: expected size 16, got %d", n, th.Size())
+		}
+		prefix := []byte("prefix")
+		sum := th.Sum(prefix)
+		if string(sum) != string(prefix)+string(full[:16]) {
+			t.Errorf("%s: expected %x, got %x", n, full[:16], sum)
+		}
+		expectPanic(t, n+": sum-after-sum", func() {
+			th.Sum(nil)
+		})
+		expectPanic(t, n+": truncate too long", func() {
+			oncehash.Truncate(h, h.Size()+1)
+		})
+	}
+}
@@ -0,0 +1,50 @@
+package proof
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/vsekhar/hashmachine"
+	"github.com/vsekhar/hashmachine/pkg/checkpoint"
+	"github.com/vsekhar/hashmachine/pkg/hm"
+	"golang.org/x/mod/sumdb/note"
+)
+
+// VerifyAgainstCheckpoint verifies pr with inputs as Verify does, and checks
+// that pr is a proof for the tree committed to by a signed checkpoint. pr must
+// have exactly one expected output, the tree's root hash; proofs with several
+// outputs must use VerifyOutputAgainstCheckpoint.
+//
+// VerifyAgainstCheckpoint returns an error if the checkpoint is not signed by
+// verifiers, if the checkpoint's root hash is not the proof's expected output,
+// if the checkpoint's size is not the proof's tree size or if the proof has a
+// log ID that is not the checkpoint's origin.
+func VerifyAgainstCheckpoint(pr *hashmachine.Proof, signed []byte, verifiers note.Verifiers, inputs [][]byte, opts ...hm.Option) (ok bool, err error) {
+	if len(pr.ExpectedOutputs) != 1 {
+		return false, fmt.Errorf("invalid proof: expected one output, got %d, use VerifyOutputAgainstCheckpoint", len(pr.ExpectedOutputs))
+	}
+	return VerifyOutputAgainstCheckpoint(pr, 0, signed, verifiers, inputs, opts...)
+}
+
+// VerifyOutputAgainstCheckpoint is like VerifyAgainstCheckpoint, but checks
+// the checkpoint's root hash against the proof's expected output at index
+// output, for proofs with several outputs.
+func VerifyOutputAgainstCheckpoint(pr *hashmachine.Proof, output int, signed []byte, verifiers note.Verifiers, inputs [][]byte, opts ...hm.Option) (ok bool, err error) {
+	if output < 0 || output >= len(pr.ExpectedOutputs) {
+		return false, fmt.Errorf("invalid proof: output index out of bounds %d, proof has %d expected outputs", output, len(pr.ExpectedOutputs))
+	}
+	c, err := checkpoint.Open(signed, verifiers)
+	if err != nil {
+		return false, err
+	}
+	if root := pr.ExpectedOutputs[output]; !bytes.Equal(root, c.Hash) {
+		return false, fmt.Errorf("proof output %x does not match checkpoint root hash %x", root, c.Hash)
+	}
+	if pr.TreeSize != c.Size {
+		return false, fmt.Errorf("proof tree size %d does not match checkpoint size %d", pr.TreeSize, c.Size)
+	}
+	if pr.LogId != "" && pr.LogId != c.Origin {
+		return false, fmt.Errorf("proof log %q does not match checkpoint origin %q", pr.LogId, c.Origin)
+	}
+	return Verify(pr, inputs, opts...)
+}
@@ -0,0 +1,135 @@
+// Package proof creates, encodes and verifies self-contained proof bundles:
+// hashmachine programs together with their expected outputs.
+package proof
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/vsekhar/hashmachine"
+	"github.com/vsekhar/hashmachine/pkg/hm"
+	"google.golang.org/protobuf/proto"
+)
+
+// New returns a proof that p produces expected as its outputs.
+func New(p *hashmachine.Program, expected ...[]byte) *hashmachine.Proof {
+	return &hashmachine.Proof{Program: p, ExpectedOutputs: expected}
+}
+
+// Create executes p with inputs and returns a proof that p produces the
+// resulting output. p must have a single output.
+func Create(p *hashmachine.Program, inputs [][]byte, opts ...hm.Option) (*hashmachine.Proof, error) {
+	_, out, err := hm.VerifyWithOutput(p, inputs, nil, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return New(p, out), nil
+}
+
+// Marshal encodes pr in the protobuf wire format.
+func Marshal(pr *hashmachine.Proof) ([]byte, error) {
+	return proto.Marshal(pr)
+}
+
+// Unmarshal decodes a proof encoded by Marshal.
+func Unmarshal(b []byte) (*hashmachine.Proof, error) {
+	pr := new(hashmachine.Proof)
+	if err := proto.Unmarshal(b, pr); err != nil {
+		return nil, err
+	}
+	return pr, nil
+}
+
+// Verify executes the proof's program with inputs and reports whether it
+// produces the proof's expected outputs.
+func Verify(pr *hashmachine.Proof, inputs [][]byte, opts ...hm.Option) (ok bool, err error) {
+	if pr.Program == nil || pr.Program.Metadata == nil {
+		return false, errors.New("invalid proof: no program")
+	}
+	return hm.VerifyOutputs(pr.Program, inputs, pr.ExpectedOutputs, opts...)
+}
+
+// Format returns a human-readable description of pr.
+func Format(pr *hashmachine.Proof) string {
+	var b strings.Builder
+	if pr.LogId != "" {
+		fmt.Fprintf(&b, "log: %s\n", pr.LogId)
+	}
+	if pr.TreeSize != 0 {
+		fmt.Fprintf(&b, "tree size: %d\n", pr.TreeSize)
+	}
+	for i, out := range pr.ExpectedOutputs {
+		fmt.Fprintf(&b, "expected output %d: %x\n", i, out)
+	}
+	p := pr.Program
+	if md := p.GetMetadata(); md != nil {
+		fmt.Fprintf(&b, "hash: %s\n", formatHashConfig(md.HashConfig))
+		for i, cfg := range md.HashConfigs {
+			fmt.Fprintf(&b, "hash %d: %s\n", i+1, formatHashConfig(cfg))
+		}
+		fmt.Fprintf(&b, "inputs: %d\n", md.ExpectedInputCount)
+		if md.ExpectedOutputCount != 0 {
+			fmt.Fprintf(&b, "outputs: %d\n", md.ExpectedOutputCount)
+		}
+		if md.BranchingFactor != 0 {
+			fmt.Fprintf(&b, "branching factor: %d\n", md.BranchingFactor)
+		}
+		if md.TypedStack {
+			b.WriteString("typed stack\n")
+		}
+		if md.Strict {
+			b.WriteString("strict\n")
+		}
+	}
+	for i, l := range p.GetLiterals() {
+		fmt.Fprintf(&b, "literal %d: %x\n", i, l)
+	}
+	for i, sub := range p.GetSubroutines() {
+		if sub.Name != "" {
+			fmt.Fprintf(&b, "subroutine %d (%s):\n", i, sub.Name)
+		} else {
+			fmt.Fprintf(&b, "subroutine %d:\n", i)
+		}
+		formatOps(&b, sub.Ops)
+	}
+	b.WriteString("ops:\n")
+	formatOps(&b, p.GetOps())
+	return b.String()
+}
+
+func formatHashConfig(cfg *hashmachine.HashConfig) string {
+	s := strings.TrimPrefix(cfg.GetHashFunction().String(), "HASHFUNCTION_")
+	if n := cfg.GetHashOutputLengthBytes(); n != 0 {
+		s += fmt.Sprintf(" (%d bytes)", n)
+	}
+	if n := cfg.GetTruncateOutputBytes(); n != 0 {
+		s += fmt.Sprintf(" truncated to %d bytes", n)
+	}
+	if cfg.GetHmac() {
+		s += " HMAC"
+	}
+	if pos := cfg.GetNodePosition(); pos != hashmachine.NodePosition_NODEPOSITION_NONE {
+		s += " committing to node " + strings.ToLower(strings.TrimPrefix(pos.String(), "NODEPOSITION_"))
+	}
+	return s
+}
+
+func formatOps(b *strings.Builder, ops []*hashmachine.Op) {
+	for i, op := range ops {
+		fmt.Fprintf(b, "  %d %s", i, strings.TrimPrefix(op.Opcode.String(), "OPCODE_"))
+		if op.Index != 0 {
+			fmt.Fprintf(b, " index=%d", op.Index)
+		}
+		if op.Length != 0 {
+			fmt.Fprintf(b, " length=%d", op.Length)
+		}
+		if op.HashConfig != 0 {
+			fmt.Fprintf(b, " hash=%d", op.HashConfig)
+		}
+		if len(op.Payload) != 0 {
+			fmt.Fprintf(b, " payload=%x", op.Payload)
+		}
+		b.WriteString("\n")
+	}
+}
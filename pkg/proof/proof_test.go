@@ -0,0 +1,200 @@
+package proof_test
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"github.com/vsekhar/hashmachine"
+	"github.com/vsekhar/hashmachine/pkg/proof"
+	"github.com/vsekhar/hashmachine/pkg/tree"
+	"golang.org/x/mod/sumdb/note"
+)
+
+var sha256Config = &hashmachine.HashConfig{
+	HashFunction: hashmachine.HashFunction_HASHFUNCTION_SHA_256,
+}
+
+func leaves(s string) [][]byte {
+	var r [][]byte
+	for _, c := range s {
+		r = append(r, []byte(string(c)))
+	}
+	return r
+}
+
+func TestProof(t *testing.T) {
+	tr, err := tree.Build(sha256Config, 2, leaves("abdehikl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := tr.Prove(0, 0, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pr, err := proof.Create(p, [][]byte{[]byte("b")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pr.LogId = "example.com/log"
+	pr.TreeSize = 8
+
+	b, err := proof.Marshal(pr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pr, err = proof.Unmarshal(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pr.LogId != "example.com/log" || pr.TreeSize != 8 {
+		t.Errorf("unexpected proof after round trip: %v", pr)
+	}
+
+	ok, err := proof.Verify(pr, [][]byte{[]byte("b")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ok {
+		t.Error("proof did not verify")
+	}
+	if ok, _ := proof.Verify(pr, [][]byte{[]byte("a")}); ok {
+		t.Error("proof verified wrong input")
+	}
+	pr.ExpectedOutputs[0] = []byte("bogus")
+	if ok, _ := proof.Verify(pr, [][]byte{[]byte("b")}); ok {
+		t.Error("proof verified with wrong expected output")
+	}
+	if _, err := proof.Verify(&hashmachine.Proof{}, nil); err == nil {
+		t.Error("expected error for proof without program")
+	}
+
+	s := proof.Format(pr)
+	for _, want := range []string{
+		"log: example.com/log\n",
+		"tree size: 8\n",
+		"expected output 0: 626f677573\n",
+		"hash: SHA_256\n",
+		"  1 PUSH_INPUT\n",
+		"  6 POP_CHILDREN_PUSH_HASH\n",
+	} {
+		if !strings.Contains(s, want) {
+			t.Errorf("formatted proof does not contain %q:\n%s", want, s)
+		}
+	}
+	for _, unwanted := range []string{"outputs:", "typed stack", "strict"} {
+		if strings.Contains(s, unwanted) {
+			t.Errorf("formatted proof contains %q:\n%s", unwanted, s)
+		}
+	}
+
+	// Metadata that changes how a program verifies is always shown.
+	pr.Program.Metadata.ExpectedOutputCount = 2
+	pr.Program.Metadata.TypedStack = true
+	pr.Program.Metadata.Strict = true
+	s = proof.Format(pr)
+	for _, want := range []string{"outputs: 2\n", "typed stack\n", "strict\n"} {
+		if !strings.Contains(s, want) {
+			t.Errorf("formatted proof does not contain %q:\n%s", want, s)
+		}
+	}
+}
+
+func TestVerifyAgainstCheckpoint(t *testing.T) {
+	tr, err := tree.Build(sha256Config, 2, leaves("abdehikl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := tr.Prove(1, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pr, err := proof.Create(p, [][]byte{[]byte("h")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pr.LogId = "example.com/log"
+	pr.TreeSize = 8
+
+	// Sign a checkpoint for the tree.
+	name := "example.com/log"
+	skey, vkey, err := note.GenerateKey(rand.Reader, name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := note.NewSigner(skey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, err := note.NewVerifier(vkey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	verifiers := note.VerifierList(v)
+	sign := func(text string) []byte {
+		msg, err := note.Sign(&note.Note{Text: text}, signer)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return msg
+	}
+	root := base64.StdEncoding.EncodeToString(tr.RootHash())
+
+	ok, err := proof.VerifyAgainstCheckpoint(pr, sign(name+"\n8\n"+root+"\n"), verifiers, [][]byte{[]byte("h")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ok {
+		t.Error("proof did not verify against checkpoint")
+	}
+	if ok, _ := proof.VerifyAgainstCheckpoint(pr, sign(name+"\n8\n"+root+"\n"), verifiers, [][]byte{[]byte("x")}); ok {
+		t.Error("proof verified wrong input against checkpoint")
+	}
+
+	other := base64.StdEncoding.EncodeToString(make([]byte, 32))
+	for desc, c := range map[string][]byte{
+		"wrong root":   sign(name + "\n8\n" + other + "\n"),
+		"wrong size":   sign(name + "\n9\n" + root + "\n"),
+		"wrong origin": sign("example.com/other\n8\n" + root + "\n"),
+		"unsigned":     []byte(name + "\n8\n" + root + "\n"),
+	} {
+		if _, err := proof.VerifyAgainstCheckpoint(pr, c, verifiers, [][]byte{[]byte("h")}); err == nil {
+			t.Errorf("%s: expected error", desc)
+		}
+	}
+
+	// Proofs with several outputs must say which one is the root hash.
+	multi := &hashmachine.Program{
+		Metadata: &hashmachine.ProgramMetadata{
+			HashConfig:          p.Metadata.HashConfig,
+			BranchingFactor:     p.Metadata.BranchingFactor,
+			ExpectedInputCount:  p.Metadata.ExpectedInputCount,
+			ExpectedOutputCount: 2,
+		},
+		Ops: append([]*hashmachine.Op{
+			{Opcode: hashmachine.OpCode_OPCODE_PUSH_BYTES, Payload: []byte("x")},
+			{Opcode: hashmachine.OpCode_OPCODE_MATCH_OUTPUT, Index: 0},
+		}, append(p.Ops, &hashmachine.Op{Opcode: hashmachine.OpCode_OPCODE_MATCH_OUTPUT, Index: 1})...),
+	}
+	mpr := proof.New(multi, []byte("x"), tr.RootHash())
+	mpr.LogId = pr.LogId
+	mpr.TreeSize = pr.TreeSize
+	c := sign(name + "\n8\n" + root + "\n")
+	if _, err := proof.VerifyAgainstCheckpoint(mpr, c, verifiers, [][]byte{[]byte("h")}); err == nil {
+		t.Error("multi-output proof: expected error without output index")
+	}
+	if _, err := proof.VerifyOutputAgainstCheckpoint(mpr, 0, c, verifiers, [][]byte{[]byte("h")}); err == nil {
+		t.Error("multi-output proof: expected error for wrong output index")
+	}
+	if _, err := proof.VerifyOutputAgainstCheckpoint(mpr, 2, c, verifiers, [][]byte{[]byte("h")}); err == nil {
+		t.Error("multi-output proof: expected error for output index out of bounds")
+	}
+	ok, err = proof.VerifyOutputAgainstCheckpoint(mpr, 1, c, verifiers, [][]byte{[]byte("h")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ok {
+		t.Error("multi-output proof did not verify against checkpoint")
+	}
+}
@@ -0,0 +1,358 @@
+// Package tree builds trees of hashes and generates hashmachine programs that
+// prove the inclusion of values in them.
+//
+// The hash of a leaf is its data, or the hash of its salt and data in salted
+// trees, or the (keyed) hash of its data in trees whose hash config uses HMAC.
+// The hash of an interior node is the hash of its children from right to left
+// followed by the node's data, if any. This matches the order in which
+// OPCODE_POP_CHILDREN_PUSH_HASH and OPCODE_POP_CHILDREN_AND_DATA_PUSH_HASH
+// hash values popped from the stack.
+package tree
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/vsekhar/hashmachine"
+	"github.com/vsekhar/hashmachine/pkg/hm"
+	"github.com/vsekhar/hashmachine/pkg/oncehash"
+	"google.golang.org/protobuf/proto"
+)
+
+// Node is a node in a tree of hashes.
+type Node struct {
+	// Data is the value of a leaf, or the optional data of an interior node.
+	Data []byte
+
+	// Children are the children of an interior node, from left to right. A
+	// node without children is a leaf.
+	Children []*Node
+}
+
+// Leaf returns a leaf node with value v.
+func Leaf(v []byte) *Node {
+	return &Node{Data: v}
+}
+
+func (n *Node) isLeaf() bool { return len(n.Children) == 0 }
+
+// Tree is a tree of hashes. A Tree must not be modified after it is created.
+type Tree struct {
+	config          *hashmachine.HashConfig
+	branchingFactor int
+	root            *Node
+
+	sorted  bool
+	hmacKey []byte
+	seed    []byte // for salted trees
+
+	h         oncehash.Hash
+	hashes    map[*Node][]byte
+	positions map[*Node]uint64 // of interior nodes, if the config commits to them
+	salts     map[*Node][]byte // of leaves, in salted trees
+	hashLeaf  bool             // whether leaves are hashed (salted or keyed trees)
+	leaves    int              // leaves hashed so far
+}
+
+// Option configures a Tree.
+type Option func(*Tree)
+
+// Sorted makes the tree commutative: the hash of an interior node is the hash
+// of its children's hashes sorted in ascending bytewise order. Proofs for
+// sorted trees use OPCODE_POP_SORTED_CHILDREN_PUSH_HASH. Interior nodes of
+// sorted trees cannot carry data.
+func Sorted() Option {
+	return func(t *Tree) { t.sorted = true }
+}
+
+// WithHMACKey sets the key for trees whose hash config uses HMAC. Proofs for
+// such trees must be verified with the same key (see hm.WithHMACKey).
+//
+// Leaves of keyed trees are hashed with the key, so that proofs reveal only
+// keyed hashes of sibling leaves rather than their values. Interior nodes of
+// keyed trees cannot carry data.
+func WithHMACKey(key []byte) Option {
+	return func(t *Tree) { t.hmacKey = key }
+}
+
+// Salted salts each leaf of the tree: the hash of a leaf is the hash of its
+// salt followed by its value, rather than its value. The salt of the i'th leaf
+// from the left is Salt(seed, i). Salting protects low-entropy values from
+// dictionary attacks on the root hash, provided seed is kept secret. A proof
+// reveals only the salt of the leaf it proves. Interior nodes of salted trees
+// cannot carry data.
+func Salted(seed []byte) Option {
+	return func(t *Tree) { t.seed = seed }
+}
+
+// Salt returns the salt of the leaf at index (counting leaves from the left)
+// of a tree salted with seed. The salt is HMAC-SHA256(seed, index), with index
+// encoded as an 8-byte big-endian integer.
+func Salt(seed []byte, index uint64) []byte {
+	mac := hmac.New(sha256.New, seed)
+	mac.Write(hm.EncodePosition(index))
+	return mac.Sum(nil)
+}
+
+// New returns a Tree rooted at root. Every interior node of the tree must have
+// exactly branchingFactor children.
+func New(config *hashmachine.HashConfig, branchingFactor int, root *Node, opts ...Option) (*Tree, error) {
+	if config == nil {
+		return nil, errors.New("missing hash config")
+	}
+	if branchingFactor < 1 {
+		return nil, fmt.Errorf("bad branching factor: %d", branchingFactor)
+	}
+	t := &Tree{
+		config:          proto.Clone(config).(*hashmachine.HashConfig),
+		branchingFactor: branchingFactor,
+		root:            root,
+		hashes:          make(map[*Node][]byte),
+		positions:       make(map[*Node]uint64),
+		salts:           make(map[*Node][]byte),
+	}
+	for _, opt := range opts {
+		opt(t)
+	}
+	t.hashLeaf = t.seed != nil || t.config.Hmac
+	h, err := hm.NewHash(config, hm.WithHMACKey(t.hmacKey))
+	if err != nil {
+		return nil, err
+	}
+	t.h = h
+	if _, err := t.hash(root, 0); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// Build returns a perfect Tree whose leaves are values, from left to right.
+// The number of values must be a power of branchingFactor.
+func Build(config *hashmachine.HashConfig, branchingFactor int, values [][]byte, opts ...Option) (*Tree, error) {
+	if len(values) == 0 {
+		return nil, errors.New("no values")
+	}
+	level := make([]*Node, len(values))
+	for i, v := range values {
+		level[i] = Leaf(v)
+	}
+	for len(level) > 1 {
+		if branchingFactor < 2 || len(level)%branchingFactor != 0 {
+			return nil, fmt.Errorf("%d values do not form a perfect tree with branching factor %d", len(values), branchingFactor)
+		}
+		next := make([]*Node, len(level)/branchingFactor)
+		for i := range next {
+			next[i] = &Node{Children: level[i*branchingFactor : (i+1)*branchingFactor]}
+		}
+		level = next
+	}
+	return New(config, branchingFactor, level[0], opts...)
+}
+
+// hash computes and records the hashes of n, whose index in level order is
+// index, and its descendants. It returns the height of n.
+func (t *Tree) hash(n *Node, index uint64) (height uint64, err error) {
+	if n.isLeaf() {
+		t.hashes[n] = n.Data
+		if t.hashLeaf {
+			t.h.Reset()
+			if t.seed != nil {
+				t.salts[n] = Salt(t.seed, uint64(t.leaves))
+				t.h.Write(t.salts[n])
+			}
+			t.h.Write(n.Data)
+			t.hashes[n] = t.h.Sum(nil)
+		}
+		t.leaves++
+		return 0, nil
+	}
+	if t.hashLeaf && len(n.Data) > 0 {
+		return 0, errors.New("interior nodes of salted or keyed trees cannot carry data")
+	}
+	if len(n.Children) != t.branchingFactor {
+		return 0, fmt.Errorf("node has %d children, expected %d", len(n.Children), t.branchingFactor)
+	}
+	bf := uint64(t.branchingFactor)
+	if t.config.NodePosition == hashmachine.NodePosition_NODEPOSITION_INDEX && index > (math.MaxUint64-bf)/bf {
+		return 0, errors.New("tree too deep to index its nodes")
+	}
+	for i, c := range n.Children {
+		ch, err := t.hash(c, index*bf+uint64(i)+1)
+		if err != nil {
+			return 0, err
+		}
+		if ch+1 > height {
+			height = ch + 1
+		}
+	}
+	switch t.config.NodePosition {
+	case hashmachine.NodePosition_NODEPOSITION_HEIGHT:
+		t.positions[n] = height
+	case hashmachine.NodePosition_NODEPOSITION_INDEX:
+		t.positions[n] = index
+	}
+	// Hash children from right to left, or in sorted order for sorted trees.
+	vals := make([][]byte, len(n.Children))
+	for i, c := range n.Children {
+		vals[len(vals)-1-i] = t.hashes[c]
+	}
+	if t.sorted {
+		if len(n.Data) > 0 {
+			return 0, errors.New("interior nodes of sorted trees cannot carry data")
+		}
+		sort.Slice(vals, func(i, j int) bool { return bytes.Compare(vals[i], vals[j]) < 0 })
+	}
+	t.h.Reset()
+	if t.config.NodePosition != hashmachine.NodePosition_NODEPOSITION_NONE {
+		t.h.Write(hm.EncodePosition(t.positions[n]))
+	}
+	for _, v := range vals {
+		t.h.Write(v)
+	}
+	t.h.Write(n.Data)
+	t.hashes[n] = t.h.Sum(nil)
+	return height, nil
+}
+
+// Root returns the root node of the tree.
+func (t *Tree) Root() *Node {
+	return t.root
+}
+
+// RootHash returns the hash of the root of the tree.
+func (t *Tree) RootHash() []byte {
+	return t.hashes[t.root]
+}
+
+// RootHashes returns the root hash of the tree rooted at root under each of
+// configs, for publishing checkpoints covering the same tree under several
+// hash functions (e.g. while migrating from one to another). ProveAll and
+// hm.VerifyMulti prove that the roots cover the same values.
+func RootHashes(configs []*hashmachine.HashConfig, branchingFactor int, root *Node, opts ...Option) ([][]byte, error) {
+	var r [][]byte
+	for i, cfg := range configs {
+		t, err := New(cfg, branchingFactor, root, opts...)
+		if err != nil {
+			return nil, fmt.Errorf("hash config %d: %w", i, err)
+		}
+		r = append(r, t.RootHash())
+	}
+	return r, nil
+}
+
+// ProveAll returns a program that recomputes the root hash of the tree from
+// all of its values. The program expects the data of each node that has data,
+// in pre-order (a node's data before that of its children), as its inputs.
+// Since the program embeds no hashes, it computes the root of the same tree
+// under any hash configuration.
+func (t *Tree) ProveAll() *hashmachine.Program {
+	var inputs uint32
+	ops := t.proveAll(t.root, &inputs, nil)
+	return &hashmachine.Program{
+		Metadata: &hashmachine.ProgramMetadata{
+			HashConfig:         proto.Clone(t.config).(*hashmachine.HashConfig),
+			ExpectedInputCount: inputs,
+			BranchingFactor:    uint32(t.branchingFactor),
+		},
+		Ops: ops,
+	}
+}
+
+func (t *Tree) proveAll(n *Node, inputs *uint32, ops []*hashmachine.Op) []*hashmachine.Op {
+	if n.isLeaf() || len(n.Data) > 0 {
+		ops = append(ops, t.pushInput(n, uint64(*inputs)))
+		*inputs++
+	}
+	if n.isLeaf() {
+		return ops
+	}
+	for _, c := range n.Children {
+		ops = t.proveAll(c, inputs, ops)
+	}
+	switch {
+	case len(n.Data) > 0:
+		return append(ops, &hashmachine.Op{Opcode: hashmachine.OpCode_OPCODE_POP_CHILDREN_AND_DATA_PUSH_HASH, Index: t.positions[n]})
+	case t.sorted:
+		return append(ops, &hashmachine.Op{Opcode: hashmachine.OpCode_OPCODE_POP_SORTED_CHILDREN_PUSH_HASH, Index: t.positions[n]})
+	default:
+		return append(ops, &hashmachine.Op{Opcode: hashmachine.OpCode_OPCODE_POP_CHILDREN_PUSH_HASH, Index: t.positions[n]})
+	}
+}
+
+// Prove returns a program proving the inclusion of the data of the node at
+// path in the tree. Path lists the index of the child to descend into at each
+// level, starting from the root. An empty path identifies the root.
+//
+// The program expects the node's data as its only input and outputs the root
+// hash.
+func (t *Tree) Prove(path ...int) (*hashmachine.Program, error) {
+	ops, err := t.prove(t.root, path, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &hashmachine.Program{
+		Metadata: &hashmachine.ProgramMetadata{
+			HashConfig:         proto.Clone(t.config).(*hashmachine.HashConfig),
+			ExpectedInputCount: 1,
+			BranchingFactor:    uint32(t.branchingFactor),
+		},
+		Ops: ops,
+	}, nil
+}
+
+func (t *Tree) prove(n *Node, path []int, ops []*hashmachine.Op) ([]*hashmachine.Op, error) {
+	if n.isLeaf() {
+		if len(path) > 0 {
+			return nil, fmt.Errorf("path descends below leaf by %d levels", len(path))
+		}
+		return append(ops, t.pushInput(n, 0)), nil
+	}
+	if len(path) == 0 {
+		// Prove the data of an interior node.
+		if t.sorted {
+			return nil, errors.New("interior nodes of sorted trees have no data to prove")
+		}
+		ops = append(ops, t.pushInput(n, 0))
+		for _, c := range n.Children {
+			ops = append(ops, &hashmachine.Op{Opcode: hashmachine.OpCode_OPCODE_PUSH_BYTES, Payload: t.hashes[c]})
+		}
+		return append(ops, &hashmachine.Op{Opcode: hashmachine.OpCode_OPCODE_POP_CHILDREN_AND_DATA_PUSH_HASH, Index: t.positions[n]}), nil
+	}
+	if path[0] < 0 || path[0] >= len(n.Children) {
+		return nil, fmt.Errorf("path index %d out of range [0, %d)", path[0], len(n.Children))
+	}
+	if len(n.Data) > 0 {
+		ops = append(ops, &hashmachine.Op{Opcode: hashmachine.OpCode_OPCODE_PUSH_BYTES, Payload: n.Data})
+	}
+	for i, c := range n.Children {
+		if i == path[0] {
+			var err error
+			if ops, err = t.prove(c, path[1:], ops); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		ops = append(ops, &hashmachine.Op{Opcode: hashmachine.OpCode_OPCODE_PUSH_BYTES, Payload: t.hashes[c]})
+	}
+	if len(n.Data) > 0 {
+		return append(ops, &hashmachine.Op{Opcode: hashmachine.OpCode_OPCODE_POP_CHILDREN_AND_DATA_PUSH_HASH, Index: t.positions[n]}), nil
+	}
+	if t.sorted {
+		return append(ops, &hashmachine.Op{Opcode: hashmachine.OpCode_OPCODE_POP_SORTED_CHILDREN_PUSH_HASH, Index: t.positions[n]}), nil
+	}
+	return append(ops, &hashmachine.Op{Opcode: hashmachine.OpCode_OPCODE_POP_CHILDREN_PUSH_HASH, Index: t.positions[n]}), nil
+}
+
+// pushInput returns the op that pushes the hash of n given its data as input
+// index.
+func (t *Tree) pushInput(n *Node, index uint64) *hashmachine.Op {
+	if t.hashLeaf && n.isLeaf() {
+		return &hashmachine.Op{Opcode: hashmachine.OpCode_OPCODE_PUSH_INPUT_HASHED, Index: index, Payload: t.salts[n]}
+	}
+	return &hashmachine.Op{Opcode: hashmachine.OpCode_OPCODE_PUSH_INPUT, Index: index}
+}
@@ -0,0 +1,322 @@
+package tree_test
+
+import (
+	"bytes"
+	"encoding/base64"
+	"testing"
+
+	"github.com/vsekhar/hashmachine"
+	"github.com/vsekhar/hashmachine/pkg/hm"
+	"github.com/vsekhar/hashmachine/pkg/tree"
+)
+
+var sha256Config = &hashmachine.HashConfig{
+	HashFunction: hashmachine.HashFunction_HASHFUNCTION_SHA_256,
+}
+
+var (
+	a = []byte("a")
+	b = []byte("b")
+)
+
+func leaves(s string) [][]byte {
+	var r [][]byte
+	for _, c := range s {
+		r = append(r, []byte(string(c)))
+	}
+	return r
+}
+
+func verifyProof(t *testing.T, tr *tree.Tree, value []byte, path ...int) {
+	t.Helper()
+	p, err := tr.Prove(path...)
+	if err != nil {
+		t.Fatalf("path %v: %v", path, err)
+	}
+	ok, err := hm.Verify(p, [][]byte{value}, tr.RootHash())
+	if err != nil {
+		t.Fatalf("path %v: %v", path, err)
+	}
+	if !ok {
+		t.Errorf("path %v: proof did not verify", path)
+	}
+	if ok, _ := hm.Verify(p, [][]byte{[]byte("bogus")}, tr.RootHash()); ok {
+		t.Errorf("path %v: proof verified bogus value", path)
+	}
+}
+
+func TestBuild(t *testing.T) {
+	// The binary tree from the README.
+	tr, err := tree.Build(sha256Config, 2, leaves("abdehikl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	o, _ := base64.RawStdEncoding.DecodeString("kZq0tPyMjPHXAlr4iHVgj5YiUn3Z/m0uCYG4gHZuVZQ")
+	if !bytes.Equal(tr.RootHash(), o) {
+		t.Errorf("unexpected root hash %x", tr.RootHash())
+	}
+	for i, v := range leaves("abdehikl") {
+		verifyProof(t, tr, v, i>>2&1, i>>1&1, i&1)
+	}
+
+	if _, err := tree.Build(sha256Config, 2, leaves("abc")); err == nil {
+		t.Error("expected error for imperfect tree")
+	}
+	if _, err := tree.Build(nil, 2, leaves("abcd")); err == nil {
+		t.Error("expected error for missing hash config")
+	}
+}
+
+func TestDataNodes(t *testing.T) {
+	//            root
+	//         /        \
+	//      left        right
+	//      /  \        /   \
+	//     a    b      c     d
+	root := &tree.Node{
+		Data: []byte("root"),
+		Children: []*tree.Node{
+			{Data: []byte("left"), Children: []*tree.Node{tree.Leaf([]byte("a")), tree.Leaf([]byte("b"))}},
+			{Data: []byte("right"), Children: []*tree.Node{tree.Leaf([]byte("c")), tree.Leaf([]byte("d"))}},
+		},
+	}
+	tr, err := tree.New(sha256Config, 2, root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	verifyProof(t, tr, []byte("root"))
+	verifyProof(t, tr, []byte("left"), 0)
+	verifyProof(t, tr, []byte("right"), 1)
+	verifyProof(t, tr, []byte("a"), 0, 0)
+	verifyProof(t, tr, []byte("d"), 1, 1)
+
+	if _, err := tr.Prove(0, 0, 0); err == nil {
+		t.Error("expected error for path below leaf")
+	}
+	if _, err := tr.Prove(2); err == nil {
+		t.Error("expected error for path out of range")
+	}
+}
+
+func TestSorted(t *testing.T) {
+	tr, err := tree.Build(sha256Config, 2, leaves("abdehikl"), tree.Sorted())
+	if err != nil {
+		t.Fatal(err)
+	}
+	unsorted, err := tree.Build(sha256Config, 2, leaves("abdehikl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(tr.RootHash(), unsorted.RootHash()) {
+		t.Error("sorted and unsorted trees have the same root hash")
+	}
+	for i, v := range leaves("abdehikl") {
+		verifyProof(t, tr, v, i>>2&1, i>>1&1, i&1)
+	}
+
+	// Sorted trees are commutative: swapping siblings doesn't change the root.
+	swapped, err := tree.Build(sha256Config, 2, leaves("badehikl"), tree.Sorted())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(tr.RootHash(), swapped.RootHash()) {
+		t.Error("swapping siblings changed the root hash of a sorted tree")
+	}
+
+	root := &tree.Node{Data: []byte("data"), Children: []*tree.Node{tree.Leaf(a), tree.Leaf(b)}}
+	if _, err := tree.New(sha256Config, 2, root, tree.Sorted()); err == nil {
+		t.Error("expected error for sorted tree with node data")
+	}
+}
+
+func TestMultipleHashConfigs(t *testing.T) {
+	sha3Config := &hashmachine.HashConfig{
+		HashFunction:          hashmachine.HashFunction_HASHFUNCTION_SHA3_512,
+		HashOutputLengthBytes: 64,
+	}
+	configs := []*hashmachine.HashConfig{sha256Config, sha3Config}
+	for _, opts := range [][]tree.Option{nil, {tree.Sorted()}} {
+		tr, err := tree.Build(sha256Config, 2, leaves("abdehikl"), opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		roots, err := tree.RootHashes(configs, 2, tr.Root(), opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(roots[0], tr.RootHash()) {
+			t.Errorf("unexpected SHA-256 root %x", roots[0])
+		}
+		if len(roots[1]) != 64 {
+			t.Errorf("unexpected SHA3 root %x", roots[1])
+		}
+		p := tr.ProveAll()
+		ok, err := hm.VerifyMulti(p, configs, leaves("abdehikl"), roots)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !ok {
+			t.Error("roots did not verify")
+		}
+		if ok, _ := hm.VerifyMulti(p, configs, leaves("abdehikx"), roots); ok {
+			t.Error("roots verified different values")
+		}
+		if ok, _ := hm.VerifyMulti(p, configs, leaves("abdehikl"), [][]byte{roots[0], roots[0]}); ok {
+			t.Error("verified SHA-256 root as SHA3 root")
+		}
+	}
+
+	// Node data is provided in pre-order.
+	root := &tree.Node{
+		Data:     []byte("root"),
+		Children: []*tree.Node{{Data: []byte("left"), Children: []*tree.Node{tree.Leaf(a), tree.Leaf(b)}}, tree.Leaf([]byte("c"))},
+	}
+	tr, err := tree.New(sha256Config, 2, root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ok, err := hm.Verify(tr.ProveAll(), [][]byte{[]byte("root"), []byte("left"), a, b, []byte("c")}, tr.RootHash())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ok {
+		t.Error("data-bearing tree did not verify")
+	}
+}
+
+func TestHMAC(t *testing.T) {
+	hmacConfig := &hashmachine.HashConfig{
+		HashFunction: hashmachine.HashFunction_HASHFUNCTION_SHA_256,
+		Hmac:         true,
+	}
+	key := []byte("secret")
+	tr, err := tree.Build(hmacConfig, 2, leaves("abdehikl"), tree.WithHMACKey(key))
+	if err != nil {
+		t.Fatal(err)
+	}
+	plain, err := tree.Build(sha256Config, 2, leaves("abdehikl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(tr.RootHash(), plain.RootHash()) {
+		t.Error("keyed and unkeyed trees have the same root hash")
+	}
+	p, err := tr.Prove(0, 1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ok, err := hm.Verify(p, [][]byte{[]byte("e")}, tr.RootHash(), hm.WithHMACKey(key))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ok {
+		t.Error("proof did not verify")
+	}
+	if ok, _ := hm.Verify(p, [][]byte{[]byte("e")}, tr.RootHash(), hm.WithHMACKey([]byte("wrong"))); ok {
+		t.Error("proof verified with wrong key")
+	}
+	for _, op := range p.Ops {
+		if bytes.Equal(op.Payload, []byte("d")) {
+			t.Error("proof reveals the value of a sibling leaf")
+		}
+	}
+	if _, err := tree.New(hmacConfig, 2, &tree.Node{Data: []byte("x"), Children: []*tree.Node{tree.Leaf(nil), tree.Leaf(nil)}}, tree.WithHMACKey(key)); err == nil {
+		t.Error("expected error for interior data in a keyed tree")
+	}
+
+	if _, err := tree.Build(hmacConfig, 2, leaves("abdehikl")); err == nil {
+		t.Error("expected error building HMAC tree without a key")
+	}
+}
+
+func TestNodePosition(t *testing.T) {
+	plain, err := tree.Build(sha256Config, 2, leaves("abdehikl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	roots := map[string]bool{string(plain.RootHash()): true}
+	for _, pos := range []hashmachine.NodePosition{hashmachine.NodePosition_NODEPOSITION_HEIGHT, hashmachine.NodePosition_NODEPOSITION_INDEX} {
+		cfg := &hashmachine.HashConfig{
+			HashFunction: hashmachine.HashFunction_HASHFUNCTION_SHA_256,
+			NodePosition: pos,
+		}
+		tr, err := tree.Build(cfg, 2, leaves("abdehikl"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if roots[string(tr.RootHash())] {
+			t.Errorf("%s: root hash does not depend on node positions", pos)
+		}
+		roots[string(tr.RootHash())] = true
+		for i, v := range leaves("abdehikl") {
+			verifyProof(t, tr, v, i>>2&1, i>>1&1, i&1)
+		}
+		ok, err := hm.Verify(tr.ProveAll(), leaves("abdehikl"), tr.RootHash())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !ok {
+			t.Errorf("%s: ProveAll did not verify", pos)
+		}
+
+		// Positions are committed to: a proof with a different position fails.
+		p, err := tr.Prove(0, 0, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		p.Ops[len(p.Ops)-1].Index++
+		if ok, _ := hm.Verify(p, [][]byte{a}, tr.RootHash()); ok {
+			t.Errorf("%s: proof verified with wrong position", pos)
+		}
+	}
+}
+
+func TestSalted(t *testing.T) {
+	seed := []byte("secret seed")
+	tr, err := tree.Build(sha256Config, 2, leaves("abdehikl"), tree.Salted(seed))
+	if err != nil {
+		t.Fatal(err)
+	}
+	plain, err := tree.Build(sha256Config, 2, leaves("abdehikl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(tr.RootHash(), plain.RootHash()) {
+		t.Error("salted and unsalted trees have the same root hash")
+	}
+	for i, v := range leaves("abdehikl") {
+		verifyProof(t, tr, v, i>>2&1, i>>1&1, i&1)
+	}
+
+	// A proof reveals the salt of its own leaf only.
+	p, err := tr.Prove(0, 1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := uint64(0); i < 8; i++ {
+		revealed := false
+		for _, op := range p.Ops {
+			revealed = revealed || bytes.Equal(op.Payload, tree.Salt(seed, i))
+		}
+		if revealed != (i == 3) {
+			t.Errorf("salt %d revealed: %t", i, revealed)
+		}
+	}
+
+	// Salts are deterministic.
+	again, err := tree.Build(sha256Config, 2, leaves("abdehikl"), tree.Salted(seed))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(tr.RootHash(), again.RootHash()) {
+		t.Error("salted tree root hash is not deterministic")
+	}
+	other, err := tree.Build(sha256Config, 2, leaves("abdehikl"), tree.Salted([]byte("other seed")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(tr.RootHash(), other.RootHash()) {
+		t.Error("salted tree root hash does not depend on seed")
+	}
+}